@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gw-currncy-wallet/internal/fakeexchanger"
+	"gw-currncy-wallet/internal/tlsutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	addr := flag.String("addr", ":50051", "listen address")
+	configPath := flag.String("config", "", "rates config, YAML or JSON (default built-in fixed rates)")
+	tlsCert := flag.String("tls-cert", "", "server certificate, enables TLS")
+	tlsKey := flag.String("tls-key", "", "server key")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA of client certificates, enables mutual TLS")
+	flag.Parse()
+
+	cfg := fakeexchanger.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		cfg, err = fakeexchanger.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+
+	srv, err := fakeexchanger.NewServer(cfg)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *addr, err)
+	}
+
+	var opts []grpc.ServerOption
+	if *tlsCert != "" {
+		tlsCfg, err := tlsutil.ServerConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	gs := grpc.NewServer(opts...)
+	hs := fakeexchanger.Register(gs, srv)
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+		log.Println("Shutting down fake exchanger...")
+		hs.Shutdown()
+		gs.GracefulStop()
+	}()
+
+	log.Printf("Fake exchanger listening on %s...", *addr)
+	if err := gs.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"gw-currncy-wallet/internal/tlsutil"
+)
+
+// gencerts writes a test CA with server and client certificates for local TLS and mTLS runs
+func main() {
+	out := flag.String("out", "certs", "output directory")
+	hosts := flag.String("hosts", "localhost,127.0.0.1,exchanger,wallet", "comma separated DNS names and IPs of the certificates")
+	validFor := flag.Duration("valid-for", 30*24*time.Hour, "certificate lifetime")
+	flag.Parse()
+
+	if err := tlsutil.GenerateTestCertificates(*out, strings.Split(*hosts, ","), *validFor); err != nil {
+		log.Fatalf("Failed to generate certificates: %v", err)
+	}
+	log.Printf("Test certificates written to %s", *out)
+}
@@ -1,68 +1,355 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "gw-currncy-wallet/docs"
+	"gw-currncy-wallet/internal/audit"
 	"gw-currncy-wallet/internal/auth"
 	"gw-currncy-wallet/internal/changer"
+	"gw-currncy-wallet/internal/config"
 	"gw-currncy-wallet/internal/handlers"
+	"gw-currncy-wallet/internal/health"
+	"gw-currncy-wallet/internal/logging"
+	"gw-currncy-wallet/internal/metrics"
+	"gw-currncy-wallet/internal/server"
 	"gw-currncy-wallet/internal/storages/postgres"
+	"gw-currncy-wallet/internal/tlsutil"
+	"gw-currncy-wallet/internal/tracing"
+	"gw-currncy-wallet/internal/webhooks"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"google.golang.org/grpc"
-
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/connectivity"
 
 	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
 )
 
 func main() {
-	db, err := postgres.Connection()
+	if err := run(); err != nil {
+		slog.Error("service failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run wires the service and blocks until SIGINT/SIGTERM.
+// Returning instead of exiting lets the deferred shutdown steps run in order:
+// HTTP drain, background workers, gRPC connection, database.
+func run() error {
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Println(err)
+		return fmt.Errorf("failed to load config: %w", err)
 	}
-	defer db.Close()
+	if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	grpcConn, err := grpc.NewClient("exchanger:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to connect to gRPC server: %v", err)
+		return err
 	}
-	defer grpcConn.Close()
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+	}()
+
+	db, err := postgres.Connection(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		slog.Info("closing database")
+		db.Close()
+	}()
+
+	if cfg.Database.AutoMigrate {
+		if err := postgres.Migrate(ctx, db); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	metrics.RegisterDB(db, cfg.Database.Name)
+
+	clientCfg, err := exchangerConfig(cfg)
+	if err != nil {
+		return err
+	}
+	grpcConn, err := changer.Dial(cfg.Exchanger.Addr, clientCfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to gRPC server: %w", err)
+	}
+	defer func() {
+		slog.Info("closing exchanger connection")
+		grpcConn.Close()
+	}()
 
 	grpcClient := proto_exchange.NewExchangeServiceClient(grpcConn)
 
-	cache := changer.RateCache(5*time.Minute, 10*time.Minute)
+	cache := changer.RateCache(cfg.Cache.TTL, cfg.Cache.CleanupInterval)
+
+	guard := changer.NewRateGuard(changer.GuardConfig{
+		DefaultMaxDeviation: cfg.RateGuard.MaxDeviation,
+		PairMaxDeviation:    cfg.RateGuard.PairMaxDeviation,
+	}, nil)
+
+	// Halts outlive restarts, they are back before the first quote is checked
+	storage := &postgres.StorageConn{DB: db, Currencies: cfg.Currencies}
+	if n, err := guard.Restore(ctx, storage); err != nil {
+		return fmt.Errorf("failed to restore rate halts: %w", err)
+	} else if n > 0 {
+		slog.Warn("currency pairs are still halted", "halts", n)
+	}
+
+	exchangerClient := changer.NewExchangerClient(grpcClient, cache, guard, clientCfg)
+
+	snapshots := changer.FileSnapshotStore{Path: cfg.Cache.SnapshotPath}
+	if cfg.Cache.SnapshotPath != "" {
+		if n, err := exchangerClient.RestoreSnapshot(ctx, snapshots); err != nil {
+			slog.Warn("rate snapshot restore failed", "error", err)
+		} else {
+			slog.Info("restored rates from snapshot", "rates", n)
+		}
+	}
+
+	workers := server.NewWorkers()
+	defer workers.Stop(cfg.HTTP.ShutdownTimeout)
+
+	warmupCtx, warmupCancel := context.WithTimeout(ctx, cfg.Cache.WarmupTimeout)
+	if err := exchangerClient.Warmup(warmupCtx); err != nil {
+		slog.Warn("rate cache warmup failed", "error", err)
+	}
+	warmupCancel()
+	if !exchangerClient.CacheWarm() {
+		workers.Go("rate-warmup", func(ctx context.Context) {
+			exchangerClient.RunWarmup(ctx, cfg.Cache.WarmupTimeout)
+		})
+	}
+
+	if cfg.Cache.SnapshotPath != "" {
+		workers.Go("rate-snapshotter", func(ctx context.Context) {
+			exchangerClient.RunSnapshotter(ctx, snapshots, cfg.Cache.SnapshotInterval)
+		})
+	}
 
-	exchangerClient := changer.NewExchangerClient(grpcClient, cache)
+	if cfg.Cache.HistoryInterval > 0 {
+		workers.Go("rate-recorder", func(ctx context.Context) {
+			exchangerClient.RunRateRecorder(ctx, storage, cfg.Cache.HistoryInterval)
+		})
+	}
+	workers.Go("hold-sweeper", func(ctx context.Context) {
+		storage.RunHoldSweeper(ctx, cfg.Holds.SweepInterval)
+	})
+	workers.Go("webhook-dispatcher", func(ctx context.Context) {
+		webhooks.NewDispatcher(storage, cfg.Webhooks).Run(ctx)
+	})
+	if cfg.Snapshots.Interval > 0 {
+		workers.Go("balance-snapshotter", func(ctx context.Context) {
+			storage.RunSnapshotter(ctx, cfg.Snapshots.Interval, cfg.Snapshots.Delay)
+		})
+	}
+	if cfg.Reconcile.Interval > 0 {
+		workers.Go("reconciler", func(ctx context.Context) {
+			storage.RunReconciler(ctx, cfg.Reconcile.Interval, cfg.Reconcile.KeepRuns)
+		})
+	}
 
-	storage := &postgres.StorageConn{DB: db}
 	walletService := handlers.NewWalletService(storage, exchangerClient)
-	userService := handlers.NewUserService(storage)
+	holdService := handlers.NewHoldService(storage, cfg.Holds.DefaultTTL, cfg.Holds.MaxTTL)
+	webhookTargets := webhooks.TargetPolicy{AllowPrivate: cfg.Webhooks.AllowPrivateTargets}
+	webhookService := handlers.NewWebhookService(storage, false, webhookTargets)
+	adminWebhookService := handlers.NewWebhookService(storage, true, webhookTargets)
+	jwtSecret := []byte(cfg.Auth.JWTSecret)
+	userService := handlers.NewUserService(storage, jwtSecret)
+	adminService := handlers.NewAdminService(exchangerClient)
+	auditService := handlers.NewAuditService(storage)
+	reconcileService := handlers.NewReconcileService(storage)
+	ratesService := handlers.NewRatesService(exchangerClient, cfg.Cache.RatesMaxAge)
 
-	r := gin.Default()
+	gin.SetMode(cfg.HTTP.Mode)
+	r := gin.New()
+	// Without trusted proxies X-Forwarded-For is ignored, a client can not choose the IP
+	// written to the logs and the audit log
+	if err := r.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	r.Use(
+		otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(traceRequest)),
+		logging.RequestIDMiddleware(),
+		audit.Middleware(),
+		logging.AccessLogMiddleware(),
+		metrics.Middleware(),
+		// Renders c.Error as the JSON error envelope, so it sits inside access log and metrics
+		handlers.ErrorMiddleware(),
+		logging.RecoveryMiddleware(),
+	)
+	r.NoRoute(handlers.NotFoundHandler)
+
+	srv, err := server.New(r, cfg.HTTP)
+	if err != nil {
+		return err
+	}
+	checker := readinessChecks(cfg, srv, db, grpcConn, exchangerClient)
 
+	r.GET("/healthz", checker.LivenessHandler)
+	r.GET("/readyz", checker.ReadinessHandler)
+	r.GET("/metrics", metrics.Handler())
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	r.POST("/api/v1/login", userService.LoginHandler)
 	r.POST("/api/v1/register", userService.RegisterHandler)
 	r.GET("/api/v1/getUser", userService.GetUserDataHandler)
+	r.GET("/api/v1/rates", ratesService.GetRatesHandler)
+	r.GET("/api/v1/rates/:from/:to", ratesService.GetRateHandler)
 
 	protected := r.Group("/api/v1")
-	protected.Use(auth.JWTMiddleware())
+	protected.Use(auth.JWTMiddleware(jwtSecret))
 	{
 		protected.GET("/balance", walletService.GetBalanceHandler)
+		protected.GET("/balance/history", walletService.NetWorthHandler)
 		protected.POST("/wallet/deposit", walletService.DepositHandler)
 		protected.POST("/wallet/withdraw", walletService.WithdrawHandler)
 		protected.POST("/wallet/exchange", walletService.ExchangeHandler)
+		protected.GET("/wallet/statements", walletService.StatementHandler)
+		protected.POST("/wallet/holds", holdService.PlaceHoldHandler)
+		protected.GET("/wallet/holds", holdService.ListHoldsHandler)
+		protected.POST("/wallet/holds/:id/capture", holdService.CaptureHoldHandler)
+		protected.POST("/wallet/holds/:id/release", holdService.ReleaseHoldHandler)
+		protected.GET("/pockets", walletService.ListPocketsHandler)
+		protected.POST("/pockets", walletService.CreatePocketHandler)
+		protected.POST("/pockets/transfer", walletService.TransferHandler)
+		protected.POST("/webhooks", webhookService.CreateWebhookHandler)
+		protected.GET("/webhooks", webhookService.ListWebhooksHandler)
+		protected.DELETE("/webhooks/:id", webhookService.DeleteWebhookHandler)
+		protected.GET("/webhooks/:id/deliveries", webhookService.ListDeliveriesHandler)
+		protected.POST("/webhooks/:id/deliveries/:delivery_id/replay", webhookService.ReplayDeliveryHandler)
+	}
+
+	if len(cfg.Admin.UserIDs) == 0 {
+		slog.Warn("no admin users configured, the admin API refuses every request", "setting", "admin.user_ids")
+	}
+	admin := r.Group("/api/v1/admin")
+	admin.Use(auth.JWTMiddleware(jwtSecret), handlers.AdminAuditMiddleware(storage), auth.AdminMiddleware(cfg.Admin.UserIDs))
+	{
+		admin.GET("/rates/halts", adminService.ListHaltsHandler)
+		admin.POST("/rates/halts/:from/:to/ack", adminService.AcknowledgeHaltHandler)
+		admin.GET("/exchanger/stats", adminService.ExchangerStatsHandler)
+		admin.DELETE("/rates/cache", adminService.InvalidateRatesHandler)
+		admin.DELETE("/rates/cache/:from/:to", adminService.InvalidateRateHandler)
+		admin.GET("/audit", auditService.AuditLogHandler)
+		admin.GET("/users/:id/balance", walletService.AdminBalanceHandler)
+		admin.GET("/users/:id/balance/history", walletService.AdminNetWorthHandler)
+		admin.GET("/transactions/:id", walletService.GetTransactionHandler)
+		admin.POST("/transactions/:id/reverse", walletService.ReverseTransactionHandler)
+		admin.GET("/reports/month-end", walletService.MonthEndReportHandler)
+		admin.POST("/reconciliation/runs", reconcileService.RunReconciliationHandler)
+		admin.GET("/reconciliation/runs", reconcileService.ListRunsHandler)
+		admin.GET("/reconciliation/runs/:id", reconcileService.GetRunHandler)
+		admin.POST("/webhooks", adminWebhookService.CreateWebhookHandler)
+		admin.GET("/webhooks", adminWebhookService.ListWebhooksHandler)
+		admin.DELETE("/webhooks/:id", adminWebhookService.DeleteWebhookHandler)
+		admin.GET("/webhooks/:id/deliveries", adminWebhookService.ListDeliveriesHandler)
+		admin.POST("/webhooks/:id/deliveries/:delivery_id/replay", adminWebhookService.ReplayDeliveryHandler)
+	}
+
+	return srv.Run(ctx)
+}
+
+// readinessChecks register the dependencies probed by /readyz
+func readinessChecks(cfg config.Config, srv *server.Server, db *sql.DB, grpcConn *grpc.ClientConn, exchangerClient *changer.ExchangerClient) *health.Checker {
+	checker := health.NewChecker(cfg.HTTP.HealthCheckTimeout)
+	exchangerHealth := changer.NewHealthChecker(grpcConn)
+
+	checker.Add("server", func(ctx context.Context) error {
+		if !srv.Ready() {
+			return errors.New("server is not accepting traffic")
+		}
+		return nil
+	})
+	checker.Add("postgres", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := postgres.PendingMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	})
+	checker.Add("exchanger_connection", func(ctx context.Context) error {
+		switch state := exchangerHealth.State(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection is %s", state)
+		}
+		return nil
+	})
+	checker.Add("exchanger_health", exchangerHealth.Check)
+	checker.Add("rate_cache", func(ctx context.Context) error {
+		if !exchangerClient.CacheWarm() {
+			return errors.New("rate cache is not warm yet")
+		}
+		return nil
+	})
+	return checker
+}
+
+// traceRequest keep probe and metrics scrapes out of traces
+func traceRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
+
+// exchangerConfig build exchanger client settings from the service config
+func exchangerConfig(cfg config.Config) (changer.ClientConfig, error) {
+	clientCfg := changer.ClientConfig{
+		CallTimeout:      cfg.Exchanger.CallTimeout,
+		MaxRetries:       cfg.Exchanger.MaxRetries,
+		BaseBackoff:      cfg.Exchanger.BaseBackoff,
+		MaxBackoff:       cfg.Exchanger.MaxBackoff,
+		BreakerThreshold: cfg.Exchanger.BreakerThreshold,
+		BreakerCooldown:  cfg.Exchanger.BreakerCooldown,
+		KeepaliveTime:    cfg.Exchanger.KeepaliveTime,
+		KeepaliveTimeout: cfg.Exchanger.KeepaliveTimeout,
+		HealthCheck:      cfg.Exchanger.HealthCheck,
+		Currencies:       cfg.Currencies,
 	}
 
-	log.Println("Starting server on :8080...")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if cfg.Exchanger.TLS.Enabled {
+		tlsCfg, err := tlsutil.ClientConfig(
+			cfg.Exchanger.TLS.CAFile,
+			cfg.Exchanger.TLS.CertFile,
+			cfg.Exchanger.TLS.KeyFile,
+			cfg.Exchanger.TLS.ServerName,
+		)
+		if err != nil {
+			return changer.ClientConfig{}, fmt.Errorf("failed to configure exchanger TLS: %w", err)
+		}
+		clientCfg.TLS = tlsCfg
 	}
+	return clientCfg, nil
 }
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+	"gw-currncy-wallet/pkg/pswcrypt"
+)
+
+func createUser(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	username := fs.String("username", "", "user name")
+	email := fs.String("email", "", "email")
+	password := fs.String("password", "", "password")
+	if err := parseFlags(fs, args, "username", "email", "password"); err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	hash, err := pswcrypt.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+	id, err := db.CreateUser(ctx, *username, *email, hash)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]any{"id": id, "username": *username, "email": *email}
+	return a.out.print(result, []string{"ID", "USERNAME", "EMAIL"}, [][]string{{strconv.Itoa(id), *username, *email}})
+}
+
+func resetPassword(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	username := fs.String("username", "", "user name")
+	password := fs.String("password", "", "new password (default random, printed once)")
+	if err := parseFlags(fs, args, "username"); err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		*password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := db.GetUserData(ctx, *username)
+	if err != nil {
+		return err
+	}
+	hash, err := pswcrypt.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err := db.SetPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+
+	result := map[string]any{"id": user.ID, "username": user.Username}
+	row := []string{strconv.Itoa(user.ID), user.Username, "-"}
+	if generated {
+		result["password"] = *password
+		row[2] = *password
+	}
+	return a.out.print(result, []string{"ID", "USERNAME", "NEW PASSWORD"}, [][]string{row})
+}
+
+func freezeUser(frozen bool) func(ctx context.Context, a *app, args []string) error {
+	name := "user unfreeze"
+	if frozen {
+		name = "user freeze"
+	}
+	return func(ctx context.Context, a *app, args []string) error {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		id := fs.Int("id", 0, "user id")
+		if err := parseFlags(fs, args, "id"); err != nil {
+			return err
+		}
+
+		db, err := a.db(ctx)
+		if err != nil {
+			return err
+		}
+		if err := db.SetFrozen(ctx, *id, frozen); err != nil {
+			return err
+		}
+
+		result := map[string]any{"id": *id, "frozen": frozen}
+		return a.out.print(result, []string{"ID", "FROZEN"}, [][]string{{strconv.Itoa(*id), strconv.FormatBool(frozen)}})
+	}
+}
+
+func adjustBalance(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("balance adjust", flag.ContinueOnError)
+	userID := fs.Int("user", 0, "user id")
+	pocket := fs.Int64("pocket", 0, "pocket id, 0 is the default pocket")
+	currency := fs.String("currency", "", "wallet currency")
+	amount := fs.Float64("amount", 0, "signed amount, negative debits the wallet")
+	reason := fs.String("reason", "", "why the balance is adjusted, stored in the ledger")
+	if err := parseFlags(fs, args, "user", "currency", "amount", "reason"); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return errors.New("balance adjust: -reason must not be empty")
+	}
+	if *amount == 0 {
+		return errors.New("balance adjust: -amount must not be zero")
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	t, err := db.AdjustBalance(ctx, *userID, *pocket, strings.ToUpper(*currency), *amount, strings.TrimSpace(*reason))
+	if err != nil {
+		return err
+	}
+	return printTransactions(a, []postgres.Transaction{*t}, t)
+}
+
+func reconcile(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	run, err := db.RunReconciliation(ctx, postgres.ReconcileCLI)
+	if err != nil {
+		return err
+	}
+	return printRun(a, run)
+}
+
+func showReconciliation(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("reconcile show", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "run id, default the latest run")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	run, err := db.ReconciliationRun(ctx, *id)
+	if err != nil {
+		return err
+	}
+	return printRun(a, run)
+}
+
+// printRun print discrepancies of the run, or the per currency totals when everything matches
+func printRun(a *app, run *postgres.ReconciliationRun) error {
+	if a.out.format == "json" || len(run.Discrepancies) == 0 {
+		rows := make([][]string, 0, len(run.Totals))
+		for _, t := range run.Totals {
+			rows = append(rows, []string{strconv.FormatInt(run.ID, 10), formatTime(run.StartedAt), t.Currency,
+				formatAmount(t.Credits), formatAmount(t.Debits), formatAmount(t.WalletTotal), formatAmount(t.TransferNet)})
+		}
+		if err := a.out.print(run, []string{"RUN", "STARTED", "CURRENCY", "CREDITS", "DEBITS", "WALLETS", "TRANSFER NET"}, rows); err != nil {
+			return err
+		}
+	} else {
+		rows := make([][]string, 0, len(run.Discrepancies))
+		for _, d := range run.Discrepancies {
+			user, pocket := "-", "-"
+			if d.Kind == postgres.DiscrepancyWallet {
+				user, pocket = strconv.Itoa(d.UserID), strconv.FormatInt(d.PocketID, 10)
+			}
+			rows = append(rows, []string{strconv.FormatInt(run.ID, 10), d.Kind, user, pocket, d.Currency,
+				formatAmount(d.Balance), formatAmount(d.LedgerSum), formatAmount(d.Difference)})
+		}
+		if err := a.out.print(run, []string{"RUN", "KIND", "USER", "POCKET", "CURRENCY", "BALANCE", "LEDGER", "DIFFERENCE"}, rows); err != nil {
+			return err
+		}
+	}
+	// Non-zero exit lets cron and CI notice a mismatch
+	if run.DiscrepancyCount > 0 {
+		return fmt.Errorf("reconciliation run %d found %d discrepancies", run.ID, run.DiscrepancyCount)
+	}
+	return nil
+}
+
+func monthEndReport(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("report month-end", flag.ContinueOnError)
+	now := time.Now().UTC()
+	previous := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	month := fs.String("month", previous.Format("2006-01"), "month as YYYY-MM")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	start, err := time.Parse("2006-01", *month)
+	if err != nil {
+		return fmt.Errorf("report month-end: invalid -month %q, want YYYY-MM", *month)
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(now) {
+		return fmt.Errorf("report month-end: %s has not ended yet", *month)
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	balances := []postgres.WalletBalance{}
+	err = db.BalancesBefore(ctx, end, func(b postgres.WalletBalance) error {
+		balances = append(balances, b)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(balances))
+	for _, b := range balances {
+		rows = append(rows, []string{strconv.Itoa(b.UserID), b.Username, strconv.FormatInt(b.PocketID, 10), b.Pocket, b.Currency, formatAmount(b.Amount)})
+	}
+	return a.out.print(balances, []string{"USER", "USERNAME", "POCKET", "NAME", "CURRENCY", "BALANCE"}, rows)
+}
+
+func verifyAudit(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	v, err := db.VerifyAudit(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries, chains := strconv.FormatInt(v.Entries, 10), strconv.Itoa(v.Chains)
+	rows := [][]string{{entries, chains, v.Head, "-", "chains intact"}}
+	if len(v.Breaks) > 0 {
+		rows = rows[:0]
+		for _, b := range v.Breaks {
+			rows = append(rows, []string{entries, chains, v.Head, strconv.FormatInt(b.ID, 10), b.Reason})
+		}
+	}
+	if err := a.out.print(v, []string{"ENTRIES", "CHAINS", "HEAD", "BROKEN ID", "RESULT"}, rows); err != nil {
+		return err
+	}
+	// Non-zero exit lets cron and CI notice tampering
+	if len(v.Breaks) > 0 {
+		return fmt.Errorf("audit log chain is broken at %d entries", len(v.Breaks))
+	}
+	return nil
+}
+
+func listTransactions(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("tx list", flag.ContinueOnError)
+	userID := fs.Int("user", 0, "only transactions of this user")
+	limit := fs.Int("limit", 20, "number of transactions")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return errors.New("tx list: -limit must be positive")
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	txs, err := db.RecentTransactions(ctx, *userID, *limit)
+	if err != nil {
+		return err
+	}
+	return printTransactions(a, txs, txs)
+}
+
+func reverseTransaction(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("tx reverse", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "transaction id, either leg of an exchange or transfer")
+	reason := fs.String("reason", "", "why the transaction is reversed, stored in the ledger")
+	force := fs.Bool("force", false, "reverse even if a wallet goes negative")
+	if err := parseFlags(fs, args, "id", "reason"); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return errors.New("tx reverse: -reason must not be empty")
+	}
+
+	db, err := a.db(ctx)
+	if err != nil {
+		return err
+	}
+	reversal, err := db.ReverseTransaction(ctx, *id, postgres.ReversalRequest{Reason: strings.TrimSpace(*reason), Force: *force})
+	if err != nil {
+		return err
+	}
+	return printTransactions(a, reversal.Entries, reversal)
+}
+
+func printTransactions(a *app, txs []postgres.Transaction, v any) error {
+	rows := make([][]string, 0, len(txs))
+	for _, t := range txs {
+		rate, related, reversal := "", "", ""
+		if t.Rate != nil {
+			rate = strconv.FormatFloat(*t.Rate, 'f', -1, 64)
+		}
+		if t.RelatedID != nil {
+			related = strconv.FormatInt(*t.RelatedID, 10)
+		}
+		switch {
+		case t.ReversalOf != nil:
+			reversal = "of " + strconv.FormatInt(*t.ReversalOf, 10)
+		case t.ReversedBy != nil:
+			reversal = "by " + strconv.FormatInt(*t.ReversedBy, 10)
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(t.ID, 10), formatTime(t.CreatedAt), strconv.Itoa(t.UserID), strconv.FormatInt(t.PocketID, 10), t.Currency, t.Kind,
+			formatAmount(t.Amount), formatAmount(t.BalanceAfter), rate, related, reversal, t.Reason,
+		})
+	}
+	return a.out.print(v, []string{"ID", "TIME", "USER", "POCKET", "CURRENCY", "KIND", "AMOUNT", "BALANCE", "RATE", "RELATED", "REVERSAL", "REASON"}, rows)
+}
+
+func invalidateCache(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("cache invalidate", flag.ContinueOnError)
+	pair := fs.String("pair", "", "currency pair FROM/TO, empty drops the whole cache")
+	api := fs.String("api", envOr("WALLETCTL_API", "http://localhost:8080"), "wallet base URL (env WALLETCTL_API)")
+	token := fs.String("token", os.Getenv("WALLETCTL_TOKEN"), "admin JWT (env WALLETCTL_TOKEN)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *token == "" {
+		return errors.New("cache invalidate: admin token is required, set -token or WALLETCTL_TOKEN")
+	}
+
+	path := "/api/v1/admin/rates/cache"
+	if *pair != "" {
+		from, to, ok := strings.Cut(strings.ToUpper(*pair), "/")
+		if !ok || from == "" || to == "" {
+			return fmt.Errorf("cache invalidate: invalid pair %q, want FROM/TO", *pair)
+		}
+		path += "/" + url.PathEscape(from) + "/" + url.PathEscape(to)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, strings.TrimRight(*api, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	scope := *pair
+	if scope == "" {
+		scope = "all"
+	}
+	result := map[string]any{"invalidated": strings.ToUpper(scope)}
+	return a.out.print(result, []string{"INVALIDATED"}, [][]string{{strings.ToUpper(scope)}})
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,188 @@
+// walletctl is the operator CLI of the wallet. Account and ledger commands
+// work on Postgres through the storage layer, cache commands go through the
+// admin API of a running wallet.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+
+	"gw-currncy-wallet/internal/audit"
+	"gw-currncy-wallet/internal/config"
+	"gw-currncy-wallet/internal/logging"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+)
+
+const usage = `usage: walletctl [-config file] [-env-file file] [-o table|json] <command> [flags]
+
+commands:
+  user create          -username NAME -email EMAIL -password PASS
+  user reset-password  -username NAME [-password PASS]
+  user freeze          -id ID
+  user unfreeze        -id ID
+  balance adjust       -user ID [-pocket ID] -currency CUR -amount N -reason TEXT
+  reconcile
+  reconcile show       [-id N]
+  tx list              [-user ID] [-limit N]
+  tx reverse           -id N -reason TEXT [-force]   (exchanges at the original rate)
+  report month-end     [-month YYYY-MM]
+  audit verify
+  cache invalidate     [-pair FROM/TO] [-api URL] [-token JWT]
+
+Database settings are read like the wallet does: YAML config, env file, environment.
+Run "walletctl <command> -h" for the flags of a command.
+`
+
+// app holds what commands share
+type app struct {
+	configArgs []string
+	out        *printer
+	storage    *postgres.StorageConn
+}
+
+type command struct {
+	name string
+	run  func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = []command{
+	{"user create", createUser},
+	{"user reset-password", resetPassword},
+	{"user freeze", freezeUser(true)},
+	{"user unfreeze", freezeUser(false)},
+	{"balance adjust", adjustBalance},
+	{"reconcile show", showReconciliation},
+	{"reconcile", reconcile},
+	{"tx list", listTransactions},
+	{"tx reverse", reverseTransaction},
+	{"report month-end", monthEndReport},
+	{"audit verify", verifyAudit},
+	{"cache invalidate", invalidateCache},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:])
+	stop()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "walletctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("walletctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	configPath := fs.String("config", "", "YAML config file of the wallet")
+	envFile := fs.String("env-file", "", "dotenv file loaded into the environment")
+	format := fs.String("o", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	a := &app{out: &printer{format: *format, w: os.Stdout}}
+	if *configPath != "" {
+		a.configArgs = append(a.configArgs, "-config", *configPath)
+	}
+	if *envFile != "" {
+		a.configArgs = append(a.configArgs, "-env-file", *envFile)
+	}
+
+	// Logs would mix with the command output, keep only warnings on stderr
+	logger, err := logging.New(os.Stderr, "warn", "text")
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	// Changes made from the CLI are audited with the operator's login as user agent
+	ctx = audit.WithMeta(ctx, operatorMeta())
+
+	rest := fs.Args()
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(rest) >= len(words) && strings.Join(rest[:len(words)], " ") == cmd.name {
+			defer a.close()
+			return cmd.run(ctx, a, rest[len(words):])
+		}
+	}
+
+	fs.Usage()
+	if len(rest) == 0 {
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown command %q", strings.Join(rest, " "))
+}
+
+// db connect to Postgres on first use, cache commands never need it
+func (a *app) db(ctx context.Context) (*postgres.StorageConn, error) {
+	if a.storage != nil {
+		return a.storage, nil
+	}
+	cfg, err := config.Load(a.configArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	db, err := postgres.Connection(ctx, cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	a.storage = &postgres.StorageConn{DB: db, Currencies: cfg.Currencies}
+	return a.storage, nil
+}
+
+func (a *app) close() {
+	if a.storage != nil {
+		a.storage.DB.Close()
+	}
+}
+
+// parseFlags parse command flags and check the required ones are set
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var missing []string
+	for _, name := range required {
+		if !set[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: missing required flags %s", fs.Name(), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// operatorMeta describe this run for the audit log, one request id covers the whole command
+func operatorMeta() audit.Meta {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return audit.Meta{UserAgent: "walletctl (" + name + ")", RequestID: hex.EncodeToString(id)}
+}
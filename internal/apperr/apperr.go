@@ -0,0 +1,96 @@
+// Package apperr holds domain errors shared by storage, exchanger and HTTP layers.
+// Every error carries a stable machine-readable code and the HTTP status it maps to.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Codes returned to API clients
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeUnknownCurrency   = "unknown_currency"
+	CodeWalletNotFound    = "wallet_not_found"
+	CodeUserNotFound      = "user_not_found"
+	CodeDuplicateUser     = "duplicate_user"
+	CodeRateUnavailable   = "rate_unavailable"
+	CodeAccountFrozen     = "account_frozen"
+	CodeHoldNotFound      = "hold_not_found"
+	CodeHoldNotActive     = "hold_not_active"
+	CodePocketNotFound    = "pocket_not_found"
+	CodeDuplicatePocket   = "duplicate_pocket"
+	CodeWebhookNotFound   = "webhook_not_found"
+	CodeDeliveryNotFound  = "delivery_not_found"
+	CodeRunNotFound       = "reconciliation_not_found"
+	CodeReconcileRunning  = "reconciliation_running"
+	CodeTxNotFound        = "transaction_not_found"
+	CodeAlreadyReversed   = "already_reversed"
+	CodeNotReversible     = "not_reversible"
+	CodeInternal          = "internal_error"
+)
+
+// Error is a domain error with a stable code and HTTP status
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New create domain error, use it for package level sentinels
+func New(code string, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// Invalid create invalid_request error with a message for the client
+func Invalid(format string, args ...any) *Error {
+	return New(CodeInvalidRequest, http.StatusBadRequest, fmt.Sprintf(format, args...))
+}
+
+var (
+	ErrInsufficientFunds = New(CodeInsufficientFunds, http.StatusUnprocessableEntity, "insufficient funds on balance")
+	ErrUnknownCurrency   = New(CodeUnknownCurrency, http.StatusBadRequest, "unknown currency")
+	ErrWalletNotFound    = New(CodeWalletNotFound, http.StatusNotFound, "wallet not found")
+	ErrUserNotFound      = New(CodeUserNotFound, http.StatusNotFound, "user not found")
+	ErrDuplicateUser     = New(CodeDuplicateUser, http.StatusConflict, "username or email already exists")
+	ErrRateUnavailable   = New(CodeRateUnavailable, http.StatusServiceUnavailable, "exchange rate unavailable")
+	ErrAccountFrozen     = New(CodeAccountFrozen, http.StatusForbidden, "account is frozen")
+	ErrHoldNotFound      = New(CodeHoldNotFound, http.StatusNotFound, "hold not found")
+	ErrHoldNotActive     = New(CodeHoldNotActive, http.StatusConflict, "hold is no longer active")
+	ErrPocketNotFound    = New(CodePocketNotFound, http.StatusNotFound, "pocket not found")
+	ErrDuplicatePocket   = New(CodeDuplicatePocket, http.StatusConflict, "pocket with this name already exists")
+	ErrWebhookNotFound   = New(CodeWebhookNotFound, http.StatusNotFound, "webhook not found")
+	ErrDeliveryNotFound  = New(CodeDeliveryNotFound, http.StatusNotFound, "webhook delivery not found")
+	ErrRunNotFound       = New(CodeRunNotFound, http.StatusNotFound, "reconciliation run not found")
+	ErrReconcileRunning  = New(CodeReconcileRunning, http.StatusConflict, "reconciliation is already running")
+	ErrTxNotFound        = New(CodeTxNotFound, http.StatusNotFound, "transaction not found")
+	ErrAlreadyReversed   = New(CodeAlreadyReversed, http.StatusConflict, "transaction is already reversed")
+	ErrNotReversible     = New(CodeNotReversible, http.StatusUnprocessableEntity, "transaction can not be reversed")
+	ErrUnauthorized      = New(CodeUnauthorized, http.StatusUnauthorized, "missing or invalid token")
+	ErrBadCredentials    = New(CodeUnauthorized, http.StatusUnauthorized, "invalid username or password")
+	ErrForbidden         = New(CodeForbidden, http.StatusForbidden, "admin access required")
+	ErrNotFound          = New(CodeNotFound, http.StatusNotFound, "not found")
+)
+
+// Public return status, code and message safe to show to clients.
+// Errors without a domain error in the chain become internal_error, and
+// server-side failures only expose the domain message, never the wrapped cause.
+func Public(err error) (status int, code, message string) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return http.StatusInternalServerError, CodeInternal, "internal server error"
+	}
+	if e.Status >= http.StatusInternalServerError {
+		return e.Status, e.Code, e.Message
+	}
+	return e.Status, e.Code, err.Error()
+}
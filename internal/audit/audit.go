@@ -0,0 +1,60 @@
+// Package audit carries who made a request and from where down to the storage layer,
+// which writes it into the hash-chained audit log together with the change itself.
+package audit
+
+import (
+	"context"
+	"strings"
+
+	"gw-currncy-wallet/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ctxKey struct{}
+
+// Meta describes the origin of a request
+type Meta struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// WithMeta put request origin into the context
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+// FromContext return request origin, the request id falls back to the one of the logger
+func FromContext(ctx context.Context) Meta {
+	m, _ := ctx.Value(ctxKey{}).(Meta)
+	if m.RequestID == "" {
+		m.RequestID = logging.RequestID(ctx)
+	}
+	return m
+}
+
+// Middleware record client IP and user agent of the request, it must run after
+// logging.RequestIDMiddleware
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithMeta(c.Request.Context(), Meta{
+			IP:        c.ClientIP(),
+			UserAgent: userAgent(c.Request.UserAgent()),
+			RequestID: logging.RequestID(c.Request.Context()),
+		}))
+		c.Next()
+	}
+}
+
+// maxUserAgent bounds what a client can write into the log
+const maxUserAgent = 512
+
+// userAgent make the header safe to store, Postgres rejects invalid UTF-8
+func userAgent(ua string) string {
+	ua = strings.ToValidUTF8(ua, "\uFFFD")
+	if len(ua) > maxUserAgent {
+		ua = strings.ToValidUTF8(ua[:maxUserAgent], "")
+	}
+	return ua
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"gw-currncy-wallet/internal/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware allows the request only for the listed admin users.
+// It must run after JWTMiddleware, which puts user_id into the context.
+func AdminMiddleware(adminIDs []int) gin.HandlerFunc {
+	admins := make(map[int]struct{}, len(adminIDs))
+	for _, id := range adminIDs {
+		admins[id] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.Error(apperr.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+
+		if _, ok := admins[userID.(int)]; !ok {
+			c.Error(apperr.ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,46 +1,44 @@
 package auth
 
 import (
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("1")
-
-
-// GenerateToken - generate JWT token for user_id
-func GenerateToken(userID int) (string, error){
+// GenerateToken - generate JWT token for user_id signed with secret
+func GenerateToken(secret []byte, userID int) (string, error) {
 	payLoad := jwt.MapClaims{
 		"user_id": userID,
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
+		"exp":     time.Now().Add(24 * time.Hour).Unix(),
 	}
 	// Generate token with payload and signing method SHA256
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payLoad)
 
 	// signing token by secret key
-	return token.SignedString(jwtKey)
+	return token.SignedString(secret)
 }
 
-//Checking the token and return user_id
-func ValidateToken(tokenString string) (int, error){
-	// Parse token string from request
-	token, err := jwt.Parse(tokenString,func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok{
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return jwtKey, nil
-	})
+// ValidateToken check the token signed with secret and return user_id
+func ValidateToken(secret []byte, tokenString string) (int, error) {
+	// Parse token string from request, only HS256 tokens with an expiry are accepted
+	token, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
 	if err != nil {
-		return 0, nil
-
+		return 0, err
 	}
+
 	// Checking the validity and presence of the payload
 	payLoad, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid{
-		userID := int(payLoad["user_id"].(float64))
-		return userID, nil
+	if !ok || !token.Valid {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+	userID, ok := payLoad["user_id"].(float64)
+	if !ok || userID <= 0 || userID != math.Trunc(userID) {
+		return 0, fmt.Errorf("%w: user_id is missing or not an id", jwt.ErrTokenInvalidClaims)
 	}
-	return 0, jwt.ErrSignatureInvalid
+	return int(userID), nil
 }
-
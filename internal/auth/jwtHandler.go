@@ -1,20 +1,22 @@
 package auth
 
 import (
-	"net/http"
 	"strings"
 
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
-// JWTMiddleware checks the token on every request and adds the user_id to the context.
-func JWTMiddleware() gin.HandlerFunc {
+// JWTMiddleware checks the token signed with secret on every request and adds the user_id to the context.
+func JWTMiddleware(secret []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract the Authorization header from the request.
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			// If the header is missing or the token does not start with "Bearer", return 401 Unauthorized.
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+			c.Error(apperr.ErrUnauthorized)
 			c.Abort()
 			return
 		}
@@ -23,9 +25,9 @@ func JWTMiddleware() gin.HandlerFunc {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// Check valid token
-		userID, err := ValidateToken(tokenString)
+		userID, err := ValidateToken(secret, tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Error(apperr.ErrUnauthorized)
 			c.Abort()
 			return
 		}
@@ -33,8 +35,9 @@ func JWTMiddleware() gin.HandlerFunc {
 		// Save the user_id into the request context.
 		// This will allow other handlers to use the user_id.
 		c.Set("user_id", userID)
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), userID))
 
 		// Pass control to the next handler.
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func signed(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestValidateToken(t *testing.T) {
+	token, err := GenerateToken(testSecret, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := ValidateToken(testSecret, token)
+	if err != nil || userID != 42 {
+		t.Fatalf("ValidateToken = %d, %v, want 42", userID, err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not a token"},
+		{"other key", signed(t, jwt.SigningMethodHS256, []byte("another secret of thirty-two bytes"), jwt.MapClaims{"user_id": 42, "exp": exp})},
+		{"unsigned", signed(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"user_id": 42, "exp": exp})},
+		{"other algorithm", signed(t, jwt.SigningMethodHS512, testSecret, jwt.MapClaims{"user_id": 42, "exp": exp})},
+		{"expired", signed(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"user_id": 42, "exp": time.Now().Add(-time.Minute).Unix()})},
+		{"no expiry", signed(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"user_id": 42})},
+		{"no user id", signed(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"exp": exp})},
+		{"user id not a number", signed(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"user_id": "42", "exp": exp})},
+		{"fractional user id", signed(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"user_id": 4.2, "exp": exp})},
+	}
+	for _, tt := range tests {
+		if userID, err := ValidateToken(testSecret, tt.token); err == nil {
+			t.Errorf("%s: ValidateToken = %d, want an error", tt.name, userID)
+		}
+	}
+}
@@ -1,33 +1,123 @@
 package changer
 
 import (
+	"sync/atomic"
 	"time"
+
+	"gw-currncy-wallet/internal/metrics"
+	"gw-currncy-wallet/internal/storages"
+
 	"github.com/patrickmn/go-cache"
 )
 
-type GetExchangeRateCache struct{
+type GetExchangeRateCache struct {
 	cache *cache.Cache
+	ttl   time.Duration
+	warm  atomic.Bool
 }
 
 // Create rate cache
-func RateCache(defaultExpiration, cleanupInterval time.Duration) *GetExchangeRateCache{
+func RateCache(defaultExpiration, cleanupInterval time.Duration) *GetExchangeRateCache {
 	return &GetExchangeRateCache{
 		cache: cache.New(defaultExpiration, cleanupInterval),
+		ttl:   defaultExpiration,
 	}
 }
 
 // Get currency from cache
-func (c *GetExchangeRateCache) Get(fromCurrency, toCurrency string) (float64, bool){
-	key := fromCurrency + "->" + toCurrency
-	value, found := c.cache.Get(key)
+func (c *GetExchangeRateCache) Get(fromCurrency, toCurrency string) (float64, bool) {
+	rate, found := c.GetRate(fromCurrency, toCurrency)
+	return rate.Rate, found
+}
+
+// Get currency from cache together with its fetch time
+func (c *GetExchangeRateCache) GetRate(fromCurrency, toCurrency string) (storages.Rate, bool) {
+	rate, found := c.peek(fromCurrency, toCurrency)
+	metrics.RateCacheLookup(found)
+	return rate, found
+}
+
+// peek read the cache without counting a lookup
+func (c *GetExchangeRateCache) peek(fromCurrency, toCurrency string) (storages.Rate, bool) {
+	value, found := c.cache.Get(pairKey(fromCurrency, toCurrency))
 	if found {
-		return value.(float64), true
+		return value.(storages.Rate), true
 	}
-	return 0, false
+	return storages.Rate{}, false
 }
 
 // Save currency to cahce
 func (c *GetExchangeRateCache) Set(fromCurrency, toCurrency string, rate float64) {
-	key := fromCurrency + "->" + toCurrency
-	c.cache.Set(key, rate, cache.DefaultExpiration)
-}
\ No newline at end of file
+	c.cache.Set(pairKey(fromCurrency, toCurrency), storages.Rate{
+		FromCurrency: fromCurrency,
+		ToCurrency:   toCurrency,
+		Rate:         rate,
+		FetchedAt:    time.Now().UTC(),
+	}, cache.DefaultExpiration)
+}
+
+// Delete currency pair from cache
+func (c *GetExchangeRateCache) Delete(fromCurrency, toCurrency string) {
+	c.cache.Delete(pairKey(fromCurrency, toCurrency))
+}
+
+// Flush remove all rates from cache
+func (c *GetExchangeRateCache) Flush() {
+	c.cache.Flush()
+}
+
+// Snapshot return all not expired rates
+func (c *GetExchangeRateCache) Snapshot() []storages.Rate {
+	items := c.cache.Items()
+	rates := make([]storages.Rate, 0, len(items))
+	for _, item := range items {
+		if rate, ok := item.Object.(storages.Rate); ok {
+			rates = append(rates, rate)
+		}
+	}
+	return rates
+}
+
+// Restore put snapshot rates back keeping their original fetch time,
+// so a rate expires when it would have expired without the restart.
+// Already stale rates are skipped. Return number of restored rates.
+func (c *GetExchangeRateCache) Restore(rates []storages.Rate) int {
+	restored := 0
+	for _, rate := range rates {
+		left := c.ttl - time.Since(rate.FetchedAt)
+		if c.ttl > 0 && left <= 0 {
+			continue
+		}
+		if c.ttl <= 0 {
+			left = cache.NoExpiration
+		}
+		c.cache.Set(pairKey(rate.FromCurrency, rate.ToCurrency), rate, left)
+		restored++
+	}
+	return restored
+}
+
+// Has reports whether every pair of the currencies is cached
+func (c *GetExchangeRateCache) Has(currencies []string) bool {
+	for _, from := range currencies {
+		for _, to := range currencies {
+			if from == to {
+				continue
+			}
+			if _, found := c.peek(from, to); !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MarkWarm flag the cache as prefetched
+func (c *GetExchangeRateCache) MarkWarm() {
+	c.warm.Store(true)
+}
+
+// Warm reports whether the startup prefetch finished
+func (c *GetExchangeRateCache) Warm() bool {
+	return c.warm.Load()
+}
@@ -4,43 +4,113 @@ import (
 	"context"
 	"fmt"
 
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/storages"
+	"gw-currncy-wallet/internal/tracing"
+
 	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
-	_ "google.golang.org/grpc/credentials/insecure"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var _ storages.Storage = (*ExchangerClient)(nil)
+
 // Exchanger Client struct
 type ExchangerClient struct {
-	client proto_exchange.ExchangeServiceClient
-	cache  *GetExchangeRateCache
+	client   proto_exchange.ExchangeServiceClient
+	cache    *GetExchangeRateCache
+	guard    *RateGuard
+	cfg      ClientConfig
+	breaker  *Breaker
+	counters clientCounters
 }
 
 // Create gRPC client with cache
-func NewExchangerClient(client proto_exchange.ExchangeServiceClient, cache *GetExchangeRateCache) *ExchangerClient {
+func NewExchangerClient(client proto_exchange.ExchangeServiceClient, cache *GetExchangeRateCache, guard *RateGuard, cfg ClientConfig) *ExchangerClient {
 	return &ExchangerClient{
-		client: client,
-		cache:  cache,
+		client:  client,
+		cache:   cache,
+		guard:   guard,
+		cfg:     cfg,
+		breaker: NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logBreakerChange),
 	}
 }
 
 // Get exchange rate through gRPC from exchange service
 func (e *ExchangerClient) GetExchangeRate(ctx context.Context, fromCurrency, toCurrency string) (float64, error) {
+	rate, err := e.GetExchangeRates(ctx, fromCurrency, toCurrency)
+	if err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// Get exchange rate with its fetch time, from cache or through gRPC
+func (e *ExchangerClient) GetExchangeRates(ctx context.Context, fromCurrency, toCurrency string) (_ storages.Rate, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExchangerClient.GetExchangeRates", trace.WithAttributes(
+		attribute.String("currency.from", fromCurrency),
+		attribute.String("currency.to", toCurrency),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for _, currency := range []string{fromCurrency, toCurrency} {
+		if !e.Enabled(currency) {
+			return storages.Rate{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+		}
+	}
+	if err := e.guard.Check(fromCurrency, toCurrency); err != nil {
+		return storages.Rate{}, err
+	}
 
-	if rate, found := e.cache.Get(fromCurrency, toCurrency); found {
+	if rate, found := e.cache.GetRate(fromCurrency, toCurrency); found {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
 		return rate, nil
 	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
 
 	req := &proto_exchange.CurrencyRequest{
 		FromCurrency: fromCurrency,
 		ToCurrency:   toCurrency,
 	}
 
-	result, err := e.client.GetExchangeRateForCurrency(ctx, req)
+	var result *proto_exchange.ExchangeRateResponse
+	err = e.invoke(ctx, "GetExchangeRateForCurrency", func(ctx context.Context) error {
+		var err error
+		result, err = e.client.GetExchangeRateForCurrency(ctx, req)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to ger currency: %v", err)
+		return storages.Rate{}, fmt.Errorf("%w: %s: %w", apperr.ErrRateUnavailable, pairKey(fromCurrency, toCurrency), err)
 	}
 
 	rate := float64(result.Rate)
+	if err := e.guard.Validate(SourceQuote, fromCurrency, toCurrency, rate); err != nil {
+		return storages.Rate{}, err
+	}
 	e.cache.Set(fromCurrency, toCurrency, rate)
 
-	return float64(result.Rate), nil
+	cached, _ := e.cache.peek(fromCurrency, toCurrency)
+	return cached, nil
+}
+
+// Guard return the rate guard of the client
+func (e *ExchangerClient) Guard() *RateGuard {
+	return e.guard
+}
+
+// InvalidateRate drop cached pair, the next request goes to the exchanger
+func (e *ExchangerClient) InvalidateRate(fromCurrency, toCurrency string) {
+	e.cache.Delete(fromCurrency, toCurrency)
+}
+
+// InvalidateRates drop the whole rate cache
+func (e *ExchangerClient) InvalidateRates() {
+	e.cache.Flush()
 }
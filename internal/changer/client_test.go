@@ -0,0 +1,190 @@
+package changer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gw-currncy-wallet/internal/fakeexchanger"
+
+	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
+)
+
+// startExchanger run the fake exchanger over bufconn and return a client wired like the wallet's
+func startExchanger(t *testing.T, cfg ClientConfig) (*ExchangerClient, *fakeexchanger.Server) {
+	t.Helper()
+
+	srv, err := fakeexchanger.NewServer(fakeexchanger.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, stop, err := fakeexchanger.StartBufconn(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stop)
+
+	guard := NewRateGuard(DefaultGuardConfig(), func(Alert) {})
+	client := NewExchangerClient(proto_exchange.NewExchangeServiceClient(conn), RateCache(time.Minute, time.Minute), guard, cfg)
+	return client, srv
+}
+
+func testClientConfig() ClientConfig {
+	cfg := DefaultClientConfig()
+	cfg.CallTimeout = time.Second
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = time.Hour
+	return cfg
+}
+
+func TestExchangeRateServedFromCache(t *testing.T) {
+	client, srv := startExchanger(t, testClientConfig())
+	ctx := context.Background()
+
+	first, err := client.GetExchangeRate(ctx, "USD", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(first-0.92) > 1e-6 {
+		t.Fatalf("USD->EUR = %v, want 0.92", first)
+	}
+
+	srv.SetRate("EUR", 0.95)
+	second, err := client.GetExchangeRate(ctx, "USD", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("cached rate changed from %v to %v", first, second)
+	}
+	if calls := client.Stats().Calls; calls != 1 {
+		t.Fatalf("exchanger calls = %d, want 1", calls)
+	}
+
+	client.InvalidateRate("USD", "EUR")
+	third, err := client.GetExchangeRate(ctx, "USD", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(third-0.95) > 1e-6 {
+		t.Fatalf("USD->EUR after invalidation = %v, want 0.95", third)
+	}
+}
+
+func TestExchangeRateGuardHaltsPair(t *testing.T) {
+	client, srv := startExchanger(t, testClientConfig())
+	ctx := context.Background()
+
+	if _, err := client.GetExchangeRate(ctx, "USD", "RUB"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A quote twice the last one is past the default 25% deviation
+	srv.SetRate("RUB", 197)
+	client.InvalidateRate("USD", "RUB")
+	if _, err := client.GetExchangeRate(ctx, "USD", "RUB"); !errors.Is(err, ErrInvalidRate) {
+		t.Fatalf("jumped quote: err = %v, want ErrInvalidRate", err)
+	}
+	if _, err := client.GetExchangeRate(ctx, "USD", "RUB"); !errors.Is(err, ErrPairHalted) {
+		t.Fatalf("halted pair: err = %v, want ErrPairHalted", err)
+	}
+	if _, err := client.GetExchangeRate(ctx, "USD", "EUR"); err != nil {
+		t.Fatalf("other pairs must keep trading: %v", err)
+	}
+
+	halts := client.Guard().Halts()
+	if len(halts) != 1 || halts[0].Source != SourceQuote {
+		t.Fatalf("halts = %+v, want one direct quote halt", halts)
+	}
+	if _, err := client.Guard().Acknowledge(ctx, "USD", "RUB", true); err != nil {
+		t.Fatal(err)
+	}
+	rate, err := client.GetExchangeRate(ctx, "USD", "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-197) > 1e-3 {
+		t.Fatalf("USD->RUB after acknowledgement = %v, want 197", rate)
+	}
+}
+
+func TestExchangeRateBreakerOpens(t *testing.T) {
+	client, srv := startExchanger(t, testClientConfig())
+	ctx := context.Background()
+
+	if err := srv.SetBehavior(fakeexchanger.Behavior{Mode: fakeexchanger.ModeFixed, ErrorRate: 1, ErrorCode: "Unavailable"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetExchangeRate(ctx, "EUR", "USD"); err == nil {
+			t.Fatal("failing exchanger returned a rate")
+		}
+	}
+	if state := client.Stats().BreakerState; state != BreakerOpen.String() {
+		t.Fatalf("breaker = %s, want open", state)
+	}
+
+	if _, err := client.GetExchangeRate(ctx, "EUR", "USD"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker: err = %v, want ErrCircuitOpen", err)
+	}
+	if stats := client.Stats(); stats.Calls != 2 || stats.Rejected != 1 {
+		t.Fatalf("stats = %+v, want 2 calls and 1 rejected", stats)
+	}
+}
+
+func TestExchangeRateCanceledCallerKeepsBreakerClosed(t *testing.T) {
+	cfg := testClientConfig()
+	cfg.BreakerThreshold = 1
+	client, _ := startExchanger(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetExchangeRate(ctx, "EUR", "USD"); err == nil {
+		t.Fatal("canceled call returned a rate")
+	}
+	if state := client.Stats().BreakerState; state != BreakerClosed.String() {
+		t.Fatalf("breaker = %s after a canceled call, want closed", state)
+	}
+	if _, err := client.GetExchangeRate(context.Background(), "EUR", "USD"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmupRetriedAfterStartupOutage(t *testing.T) {
+	cfg := testClientConfig()
+	cfg.BreakerThreshold = 0
+	client, srv := startExchanger(t, cfg)
+
+	if err := srv.SetBehavior(fakeexchanger.Behavior{Mode: fakeexchanger.ModeFixed, ErrorRate: 1, ErrorCode: "Unavailable"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Warmup(context.Background()); err == nil || client.CacheWarm() {
+		t.Fatal("warmup succeeded during an outage")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.RunWarmup(ctx, time.Second)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if err := srv.SetBehavior(fakeexchanger.Behavior{Mode: fakeexchanger.ModeFixed}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warmup was not retried")
+	}
+	if !client.CacheWarm() {
+		t.Fatal("cache is not warm after the exchanger came back")
+	}
+}
@@ -0,0 +1,81 @@
+package changer
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// healthServiceConfig turns on client-side health checking, so the channel
+// only routes to backends whose health service reports SERVING.
+const healthServiceConfig = `{"healthCheckConfig": {"serviceName": ""}}`
+
+// Dial create gRPC connection to the exchanger with keepalive, health checking and optional TLS
+func Dial(addr string, cfg ClientConfig, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLS != nil {
+		creds = credentials.NewTLS(cfg.TLS)
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// Client spans, trace context goes to the exchanger in gRPC metadata
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if cfg.KeepaliveTime > 0 {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	if cfg.HealthCheck {
+		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(healthServiceConfig))
+	}
+	dialOpts = append(dialOpts, opts...)
+
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exchanger connection: %w", err)
+	}
+	return conn, nil
+}
+
+// HealthChecker asks the exchanger's standard gRPC health service
+type HealthChecker struct {
+	conn   *grpc.ClientConn
+	client healthpb.HealthClient
+}
+
+// NewHealthChecker create health checker on the exchanger connection
+func NewHealthChecker(conn *grpc.ClientConn) *HealthChecker {
+	return &HealthChecker{
+		conn:   conn,
+		client: healthpb.NewHealthClient(conn),
+	}
+}
+
+// Check return nil if the exchanger reports SERVING
+func (h *HealthChecker) Check(ctx context.Context) error {
+	resp, err := h.client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("exchanger health check failed: %w", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("exchanger is %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// State return connectivity state of the connection
+func (h *HealthChecker) State() connectivity.State {
+	return h.conn.GetState()
+}
@@ -0,0 +1,266 @@
+package changer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+)
+
+var (
+	// ErrInvalidRate is returned when a quote fails the sanity checks
+	ErrInvalidRate = apperr.New(apperr.CodeRateUnavailable, http.StatusServiceUnavailable, "exchange rate rejected by sanity guard")
+	// ErrPairHalted is returned while trading on a pair waits for an admin acknowledgement
+	ErrPairHalted = apperr.New(apperr.CodeRateUnavailable, http.StatusServiceUnavailable, "trading on currency pair is halted")
+	// ErrNoHalt is returned when acknowledging a pair that is not halted
+	ErrNoHalt = apperr.New(apperr.CodeNotFound, http.StatusNotFound, "currency pair is not halted")
+)
+
+// GuardConfig holds deviation thresholds of the rate guard.
+// A deviation of 0.25 rejects quotes more than 25% away from the last accepted rate.
+type GuardConfig struct {
+	DefaultMaxDeviation float64
+	// Per pair overrides, key is "FROM->TO"
+	PairMaxDeviation map[string]float64
+}
+
+// DefaultGuardConfig return default guard thresholds
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{DefaultMaxDeviation: 0.25}
+}
+
+// RateSource tells direct pair quotes from rates crossed over the base rates of the bulk call.
+// Every source keeps its own reference rates, so a cross rate is never compared to a direct quote.
+type RateSource string
+
+const (
+	SourceQuote RateSource = "quote"
+	SourceCross RateSource = "cross"
+)
+
+// Halt describes a rejected quote that stopped trading on a pair
+type Halt struct {
+	FromCurrency string     `json:"from_currency"`
+	ToCurrency   string     `json:"to_currency"`
+	Source       RateSource `json:"source" example:"quote"`
+	RejectedRate float64    `json:"rejected_rate"`
+	LastRate     float64    `json:"last_rate,omitempty"`
+	Reason       string     `json:"reason"`
+	HaltedAt     time.Time  `json:"halted_at"`
+}
+
+// HaltStore keeps halts across restarts
+type HaltStore interface {
+	SaveHalt(ctx context.Context, halt Halt) error
+	DeleteHalt(ctx context.Context, fromCurrency, toCurrency string) error
+	LoadHalts(ctx context.Context) ([]Halt, error)
+}
+
+// haltStoreTimeout bounds saving a halt raised outside of any request
+const haltStoreTimeout = 5 * time.Second
+
+// Alert is emitted every time the guard rejects a quote
+type Alert struct {
+	Halt
+}
+
+// RateGuard validates quotes coming from the exchanger before they are used
+type RateGuard struct {
+	mu      sync.Mutex
+	cfg     GuardConfig
+	last    map[string]float64
+	halted  map[string]Halt
+	store   HaltStore
+	onAlert func(Alert)
+}
+
+// NewRateGuard create rate guard, onAlert may be nil to only log alerts
+func NewRateGuard(cfg GuardConfig, onAlert func(Alert)) *RateGuard {
+	if onAlert == nil {
+		onAlert = logAlert
+	}
+	return &RateGuard{
+		cfg:     cfg,
+		last:    make(map[string]float64),
+		halted:  make(map[string]Halt),
+		onAlert: onAlert,
+	}
+}
+
+func pairKey(fromCurrency, toCurrency string) string {
+	return fromCurrency + "->" + toCurrency
+}
+
+// baselineKey is where the reference rate of a pair from one source is kept
+func baselineKey(source RateSource, key string) string {
+	return string(source) + ":" + key
+}
+
+// Check return ErrPairHalted if trading on the pair is stopped
+func (g *RateGuard) Check(fromCurrency, toCurrency string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.halted[pairKey(fromCurrency, toCurrency)]; ok {
+		return fmt.Errorf("%w: %s", ErrPairHalted, pairKey(fromCurrency, toCurrency))
+	}
+	return nil
+}
+
+// Validate accept or reject a fresh rate against the last one accepted from the same source.
+// Rejection halts the pair and raises an alert.
+func (g *RateGuard) Validate(source RateSource, fromCurrency, toCurrency string, rate float64) error {
+	key := pairKey(fromCurrency, toCurrency)
+
+	g.mu.Lock()
+	if _, ok := g.halted[key]; ok {
+		g.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrPairHalted, key)
+	}
+
+	last, hasLast := g.last[baselineKey(source, key)]
+	var reason string
+	switch {
+	case math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0:
+		reason = fmt.Sprintf("non-positive or invalid rate %v", rate)
+	case hasLast:
+		limit := g.maxDeviation(key)
+		if deviation := math.Abs(rate-last) / last; limit > 0 && deviation > limit {
+			reason = fmt.Sprintf("rate deviates %.2f%% from last accepted %v (limit %.2f%%)", deviation*100, last, limit*100)
+		}
+	}
+
+	if reason == "" {
+		g.last[baselineKey(source, key)] = rate
+		g.mu.Unlock()
+		return nil
+	}
+
+	halt := Halt{
+		FromCurrency: fromCurrency,
+		ToCurrency:   toCurrency,
+		Source:       source,
+		RejectedRate: rate,
+		LastRate:     last,
+		Reason:       reason,
+		HaltedAt:     time.Now(),
+	}
+	g.halted[key] = halt
+	store := g.store
+	g.mu.Unlock()
+
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), haltStoreTimeout)
+		if err := store.SaveHalt(ctx, halt); err != nil {
+			slog.Error("failed to persist rate guard halt", "pair", key, "error", err)
+		}
+		cancel()
+	}
+
+	metrics.RateRejected(key)
+	g.onAlert(Alert{Halt: halt})
+	return fmt.Errorf("%w: %s: %s", ErrInvalidRate, key, reason)
+}
+
+// Seed set the reference rate of a pair that has none yet, e.g. from a cache snapshot.
+// A snapshot does not tell sources apart, so it is the reference of both until fresh rates arrive.
+func (g *RateGuard) Seed(fromCurrency, toCurrency string, rate float64) {
+	if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return
+	}
+	key := pairKey(fromCurrency, toCurrency)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, source := range []RateSource{SourceQuote, SourceCross} {
+		if _, ok := g.last[baselineKey(source, key)]; !ok {
+			g.last[baselineKey(source, key)] = rate
+		}
+	}
+}
+
+// Restore load the persisted halts and persist every halt and acknowledgement from now on.
+// The last accepted rate of a halted pair becomes its reference rate unless it has one.
+func (g *RateGuard) Restore(ctx context.Context, store HaltStore) (int, error) {
+	halts, err := store.LoadHalts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.store = store
+	for _, h := range halts {
+		key := pairKey(h.FromCurrency, h.ToCurrency)
+		g.halted[key] = h
+		if _, ok := g.last[baselineKey(h.Source, key)]; !ok && h.LastRate > 0 {
+			g.last[baselineKey(h.Source, key)] = h.LastRate
+		}
+	}
+	return len(halts), nil
+}
+
+// Halts return all currently halted pairs
+func (g *RateGuard) Halts() []Halt {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	halts := make([]Halt, 0, len(g.halted))
+	for _, h := range g.halted {
+		halts = append(halts, h)
+	}
+	sort.Slice(halts, func(i, j int) bool { return halts[i].HaltedAt.Before(halts[j].HaltedAt) })
+	return halts
+}
+
+// Acknowledge resume trading on a halted pair.
+// With acceptRate the rejected quote becomes the new reference rate,
+// otherwise the next quote is compared against the previous accepted one.
+// The persisted halt is removed first, so a failure leaves the pair halted.
+func (g *RateGuard) Acknowledge(ctx context.Context, fromCurrency, toCurrency string, acceptRate bool) (Halt, error) {
+	key := pairKey(fromCurrency, toCurrency)
+
+	g.mu.Lock()
+	halt, ok := g.halted[key]
+	store := g.store
+	g.mu.Unlock()
+
+	if !ok {
+		return Halt{}, fmt.Errorf("%w: %s", ErrNoHalt, key)
+	}
+	if acceptRate && (halt.RejectedRate <= 0 || math.IsNaN(halt.RejectedRate) || math.IsInf(halt.RejectedRate, 0)) {
+		return Halt{}, fmt.Errorf("%w: rate %v can not be accepted", ErrInvalidRate, halt.RejectedRate)
+	}
+	if store != nil {
+		if err := store.DeleteHalt(ctx, fromCurrency, toCurrency); err != nil {
+			return Halt{}, fmt.Errorf("failed to remove halt: %w", err)
+		}
+	}
+
+	// A halted pair takes no new quotes, so nothing changed it in between
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if acceptRate {
+		g.last[baselineKey(halt.Source, key)] = halt.RejectedRate
+	}
+	delete(g.halted, key)
+	slog.Info("rate guard halt acknowledged", "pair", key, "accept_rate", acceptRate)
+	return halt, nil
+}
+
+func (g *RateGuard) maxDeviation(key string) float64 {
+	if d, ok := g.cfg.PairMaxDeviation[key]; ok {
+		return d
+	}
+	return g.cfg.DefaultMaxDeviation
+}
+
+func logAlert(a Alert) {
+	slog.Error("rate guard halted pair", "alert", true, "pair", pairKey(a.FromCurrency, a.ToCurrency), "source", a.Source, "reason", a.Reason, "rejected_rate", a.RejectedRate, "last_rate", a.LastRate)
+}
@@ -0,0 +1,35 @@
+package changer
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gw-currncy-wallet/internal/storages"
+)
+
+// RateRecorder keeps the rates used for historical valuations
+type RateRecorder interface {
+	RecordRates(ctx context.Context, rates []storages.Rate) (int, error)
+}
+
+// RunRateRecorder record all current rates every interval until ctx is done
+func (e *ExchangerClient) RunRateRecorder(ctx context.Context, store RateRecorder, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rates, err := e.GetAllExchangeRates(ctx)
+			if err == nil {
+				_, err = store.RecordRates(ctx, rates)
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.Error("rate history recording failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package changer
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+	"gw-currncy-wallet/internal/storages"
+
+	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
+)
+
+// ErrUnknownCurrency is returned for currencies that are not enabled
+var ErrUnknownCurrency = apperr.ErrUnknownCurrency
+
+// Currencies return enabled currencies
+func (e *ExchangerClient) Currencies() []string {
+	return slices.Clone(e.cfg.Currencies)
+}
+
+// Enabled reports whether the currency is enabled
+func (e *ExchangerClient) Enabled(currency string) bool {
+	return slices.Contains(e.cfg.Currencies, currency)
+}
+
+// GetAllExchangeRates return rates for every pair of enabled currencies.
+// Cached pairs are served from cache, missing ones are filled with one bulk gRPC call.
+// Pairs halted by the rate guard are left out.
+func (e *ExchangerClient) GetAllExchangeRates(ctx context.Context) ([]storages.Rate, error) {
+	var (
+		rates   []storages.Rate
+		missing [][2]string
+	)
+	for _, from := range e.cfg.Currencies {
+		for _, to := range e.cfg.Currencies {
+			if from == to || e.guard.Check(from, to) != nil {
+				continue
+			}
+			if rate, found := e.cache.GetRate(from, to); found {
+				rates = append(rates, rate)
+				continue
+			}
+			missing = append(missing, [2]string{from, to})
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := e.fetchAll(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, fetched...)
+	}
+
+	slices.SortFunc(rates, func(a, b storages.Rate) int {
+		if a.FromCurrency != b.FromCurrency {
+			return cmp.Compare(a.FromCurrency, b.FromCurrency)
+		}
+		return cmp.Compare(a.ToCurrency, b.ToCurrency)
+	})
+	return rates, nil
+}
+
+// fetchAll load the given pairs with the bulk GetExchangeRates call.
+// The exchanger returns every currency against one base, so the pair rate is rates[to] / rates[from].
+// These cross rates are guarded apart from direct quotes, pairs the response can not price are reported.
+func (e *ExchangerClient) fetchAll(ctx context.Context, pairs [][2]string) ([]storages.Rate, error) {
+	var result *proto_exchange.ExchangeRatesResponse
+	err := e.invoke(ctx, "GetExchangeRates", func(ctx context.Context) error {
+		var err error
+		result, err = e.client.GetExchangeRates(ctx, &proto_exchange.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperr.ErrRateUnavailable, err)
+	}
+
+	base := result.GetRates()
+	rates := make([]storages.Rate, 0, len(pairs))
+	var unpriced []string
+	for _, pair := range pairs {
+		from, to := pair[0], pair[1]
+		fromRate, okFrom := base[from]
+		toRate, okTo := base[to]
+		if !okFrom || !okTo {
+			unpriced = append(unpriced, pairKey(from, to))
+			continue
+		}
+
+		var rate float64
+		if fromRate != 0 {
+			rate = float64(toRate) / float64(fromRate)
+		}
+		if err := e.guard.Validate(SourceCross, from, to, rate); err != nil {
+			slog.WarnContext(ctx, "skipping rejected rate", "pair", pairKey(from, to), "error", err)
+			continue
+		}
+		e.cache.Set(from, to, rate)
+		if cached, found := e.cache.peek(from, to); found {
+			rates = append(rates, cached)
+		}
+	}
+	if len(unpriced) > 0 {
+		metrics.RatesUnpriced(len(unpriced))
+		slog.WarnContext(ctx, "bulk rates response lacks currencies of enabled pairs", "pairs", unpriced)
+	}
+	return rates, nil
+}
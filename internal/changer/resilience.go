@@ -0,0 +1,169 @@
+package changer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"gw-currncy-wallet/internal/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClientConfig holds the resilience settings of the exchanger client
+type ClientConfig struct {
+	// Timeout for a single gRPC attempt
+	CallTimeout time.Duration
+	// Number of retries after the first attempt
+	MaxRetries int
+	// Backoff between retries grows from BaseBackoff up to MaxBackoff with full jitter
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Consecutive failures before the breaker opens, 0 disables the breaker
+	BreakerThreshold int
+	// How long the breaker stays open before letting a probe through
+	BreakerCooldown time.Duration
+	// Keepalive pings on the gRPC connection
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+	// Enable gRPC client-side health checking
+	HealthCheck bool
+	// Currencies served by the bulk rates call
+	Currencies []string
+	// TLS of the exchanger connection, nil means plaintext
+	TLS *tls.Config
+}
+
+// DefaultClientConfig return sane defaults for the exchanger client
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		CallTimeout:      2 * time.Second,
+		MaxRetries:       3,
+		BaseBackoff:      100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		KeepaliveTime:    30 * time.Second,
+		KeepaliveTimeout: 10 * time.Second,
+		HealthCheck:      true,
+		Currencies:       []string{"USD", "EUR", "RUB"},
+	}
+}
+
+// ClientStats is a snapshot of the exchanger client counters
+type ClientStats struct {
+	Calls        uint64 `json:"calls"`
+	Retries      uint64 `json:"retries"`
+	Failures     uint64 `json:"failures"`
+	Rejected     uint64 `json:"rejected"`
+	BreakerState string `json:"breaker_state"`
+}
+
+type clientCounters struct {
+	calls    atomic.Uint64
+	retries  atomic.Uint64
+	failures atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// retryable reports whether the gRPC error is worth another attempt
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// backoff return jittered delay before the given retry (1-based)
+func (c ClientConfig) backoff(retry int) time.Duration {
+	d := c.BaseBackoff << (retry - 1)
+	if d <= 0 || d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+// invoke runs call through the breaker with per-attempt timeout and retries
+func (e *ExchangerClient) invoke(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	if err := e.breaker.Allow(); err != nil {
+		e.counters.rejected.Add(1)
+		metrics.ExchangerBreakerRejected()
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt <= e.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			e.counters.retries.Add(1)
+			metrics.ExchangerRetry(method)
+			delay := e.cfg.backoff(attempt)
+			slog.WarnContext(ctx, "retrying exchanger call", "method", method, "attempt", attempt+1, "delay", delay, "error", err)
+			select {
+			case <-ctx.Done():
+				e.breaker.Abandon()
+				return errors.Join(ctx.Err(), err)
+			case <-time.After(delay):
+			}
+		}
+
+		e.counters.calls.Add(1)
+		start := time.Now()
+		err = e.attempt(ctx, call)
+		metrics.ExchangerCall(method, time.Since(start), err)
+		if err == nil {
+			e.breaker.Success()
+			return nil
+		}
+		e.counters.failures.Add(1)
+		if !retryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Only count transport-level problems against the breaker,
+	// a NotFound or InvalidArgument answer means the exchanger is alive.
+	// A caller that gave up says nothing about the exchanger either way.
+	switch {
+	case ctx.Err() != nil:
+		e.breaker.Abandon()
+	case retryable(err):
+		e.breaker.Failure()
+	default:
+		e.breaker.Success()
+	}
+	return err
+}
+
+func (e *ExchangerClient) attempt(ctx context.Context, call func(ctx context.Context) error) error {
+	if e.cfg.CallTimeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.CallTimeout)
+	defer cancel()
+	return call(ctx)
+}
+
+// Stats return counters of the client for observability
+func (e *ExchangerClient) Stats() ClientStats {
+	return ClientStats{
+		Calls:        e.counters.calls.Load(),
+		Retries:      e.counters.retries.Load(),
+		Failures:     e.counters.failures.Load(),
+		Rejected:     e.counters.rejected.Load(),
+		BreakerState: e.breaker.State().String(),
+	}
+}
+
+func logBreakerChange(from, to BreakerState) {
+	slog.Warn("exchanger circuit breaker state changed", "from", from.String(), "to", to.String())
+	metrics.ExchangerBreakerState(int(to))
+}
@@ -0,0 +1,150 @@
+package changer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gw-currncy-wallet/internal/storages"
+)
+
+// SnapshotStore persists rate cache snapshots between restarts
+type SnapshotStore interface {
+	Save(ctx context.Context, rates []storages.Rate) error
+	Load(ctx context.Context) ([]storages.Rate, error)
+}
+
+// FileSnapshotStore keeps the snapshot in a JSON file
+type FileSnapshotStore struct {
+	Path string
+}
+
+type snapshotFile struct {
+	SavedAt time.Time       `json:"saved_at"`
+	Rates   []storages.Rate `json:"rates"`
+}
+
+// Save write snapshot atomically through a temp file and rename
+func (s FileSnapshotStore) Save(_ context.Context, rates []storages.Rate) error {
+	data, err := json.Marshal(snapshotFile{SavedAt: time.Now().UTC(), Rates: rates})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load read snapshot, a missing file is an empty snapshot
+func (s FileSnapshotStore) Load(_ context.Context) ([]storages.Rate, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return file.Rates, nil
+}
+
+// RestoreSnapshot load snapshot into the cache and seed the rate guard with it
+func (e *ExchangerClient) RestoreSnapshot(ctx context.Context, store SnapshotStore) (int, error) {
+	rates, err := store.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, rate := range rates {
+		e.guard.Seed(rate.FromCurrency, rate.ToCurrency, rate.Rate)
+	}
+	return e.cache.Restore(rates), nil
+}
+
+// Warmup prefetch all enabled pairs with the bulk call and mark the cache warm
+func (e *ExchangerClient) Warmup(ctx context.Context) error {
+	if _, err := e.GetAllExchangeRates(ctx); err != nil {
+		// A fresh enough snapshot is as good as a prefetch
+		if e.cache.Has(e.cfg.Currencies) {
+			e.cache.MarkWarm()
+		}
+		return fmt.Errorf("failed to warm up rate cache: %w", err)
+	}
+	e.cache.MarkWarm()
+	return nil
+}
+
+// warmupMaxBackoff caps the pause between warmup retries
+const warmupMaxBackoff = time.Minute
+
+// RunWarmup retry Warmup with growing pauses until the cache is warm or ctx is done,
+// so readiness recovers when the exchanger comes back after a startup outage
+func (e *ExchangerClient) RunWarmup(ctx context.Context, timeout time.Duration) {
+	delay := time.Second
+	for attempt := 1; !e.cache.Warm(); attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := e.Warmup(attemptCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("rate cache warmup retry failed", "attempt", attempt, "next_in", min(2*delay, warmupMaxBackoff), "error", err)
+		}
+		delay = min(2*delay, warmupMaxBackoff)
+	}
+	slog.Info("rate cache warm")
+}
+
+// CacheWarm reports whether the rate cache finished its startup prefetch
+func (e *ExchangerClient) CacheWarm() bool {
+	return e.cache.Warm()
+}
+
+// RunSnapshotter save the cache every interval until ctx is done, then save once more
+func (e *ExchangerClient) RunSnapshotter(ctx context.Context, store SnapshotStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	save := func(ctx context.Context) {
+		if err := store.Save(ctx, e.cache.Snapshot()); err != nil {
+			slog.Error("rate cache snapshot failed", "error", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			save(context.Background())
+			return
+		case <-ticker.C:
+			save(ctx)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Config is the typed configuration of the wallet service.
+// Values are resolved as defaults < YAML file < environment < flags.
+type Config struct {
+	HTTP       HTTP      `yaml:"http"`
+	Log        Log       `yaml:"log"`
+	Tracing    Tracing   `yaml:"tracing"`
+	Database   Database  `yaml:"database"`
+	Exchanger  Exchanger `yaml:"exchanger"`
+	Cache      Cache     `yaml:"cache"`
+	RateGuard  RateGuard `yaml:"rate_guard"`
+	Holds      Holds     `yaml:"holds"`
+	Webhooks   Webhooks  `yaml:"webhooks"`
+	Reconcile  Reconcile `yaml:"reconciliation"`
+	Snapshots  Snapshots `yaml:"balance_snapshots"`
+	Auth       Auth      `yaml:"auth"`
+	Admin      Admin     `yaml:"admin"`
+	Currencies []string  `yaml:"currencies"`
+}
+
+type HTTP struct {
+	Addr string `yaml:"addr"`
+	// Gin mode: debug, release or test
+	Mode              string        `yaml:"mode"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// How long the service reports not ready before it stops accepting connections
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// Upper bound for the whole graceful shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Timeout of every dependency check of the readiness probe
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+	// Serve HTTPS when both are set, the pair is reloaded when the files change
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	// Proxies, as IPs or CIDRs, whose X-Forwarded-For is believed. When empty the client IP
+	// in logs and the audit log is always the peer address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type Log struct {
+	// debug, info, warn or error
+	Level string `yaml:"level"`
+	// json or text
+	Format string `yaml:"format"`
+}
+
+type Tracing struct {
+	// none, stdout, otlp-grpc or otlp-http
+	Exporter string `yaml:"exporter"`
+	// OTLP collector host:port
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type Database struct {
+	// Full DSN or postgres:// URL, replaces the separate connection fields
+	URL      string `yaml:"url"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"ssl_mode"`
+	// Apply pending migrations on startup
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// Connection pool, 0 max open means unlimited
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// statement_timeout of every session, 0 disables it
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// Startup retries while Postgres is not reachable yet
+	ConnectRetries    int           `yaml:"connect_retries"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff"`
+}
+
+type Exchanger struct {
+	Addr             string        `yaml:"addr"`
+	CallTimeout      time.Duration `yaml:"call_timeout"`
+	MaxRetries       int           `yaml:"max_retries"`
+	BaseBackoff      time.Duration `yaml:"base_backoff"`
+	MaxBackoff       time.Duration `yaml:"max_backoff"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+	KeepaliveTime    time.Duration `yaml:"keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout"`
+	HealthCheck      bool          `yaml:"health_check"`
+	TLS              ExchangerTLS  `yaml:"tls"`
+}
+
+type ExchangerTLS struct {
+	Enabled bool `yaml:"enabled"`
+	// CA verifying the exchanger certificate, system roots when empty
+	CAFile string `yaml:"ca_file"`
+	// Client pair for mutual TLS
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+type Cache struct {
+	TTL              time.Duration `yaml:"ttl"`
+	CleanupInterval  time.Duration `yaml:"cleanup_interval"`
+	SnapshotPath     string        `yaml:"snapshot_path"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	WarmupTimeout    time.Duration `yaml:"warmup_timeout"`
+	// Cache-Control max-age of the public rates API
+	RatesMaxAge time.Duration `yaml:"rates_max_age"`
+	// How often all rates are recorded for historical valuations, 0 disables it
+	HistoryInterval time.Duration `yaml:"history_interval"`
+}
+
+type RateGuard struct {
+	// 0.25 rejects quotes more than 25% away from the last accepted rate
+	MaxDeviation float64 `yaml:"max_deviation"`
+	// Per pair overrides, key is "FROM->TO"
+	PairMaxDeviation map[string]float64 `yaml:"pair_max_deviation"`
+}
+
+type Holds struct {
+	// Expiry of a hold when the request does not set one
+	DefaultTTL time.Duration `yaml:"default_ttl"`
+	MaxTTL     time.Duration `yaml:"max_ttl"`
+	// How often expired holds are released
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+type Webhooks struct {
+	// How often the outbox is polled for new events and due deliveries
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// Concurrent HTTP deliveries
+	Workers int           `yaml:"workers"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Failed deliveries are retried with exponential backoff, after MaxAttempts they are dead
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	// Deliver to loopback, private and link-local addresses too, for local development only
+	AllowPrivateTargets bool `yaml:"allow_private_targets"`
+}
+
+type Reconcile struct {
+	// How often wallets are checked against the ledger, 0 disables the scheduled job
+	Interval time.Duration `yaml:"interval"`
+	// Runs kept in the report tables, older ones are deleted
+	KeepRuns int `yaml:"keep_runs"`
+}
+
+type Snapshots struct {
+	// How often the job looks for UTC midnights without a balance snapshot, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+	// A midnight is snapshotted only this long after it passed, so transactions still
+	// committing with an earlier timestamp are included
+	Delay time.Duration `yaml:"delay"`
+}
+
+type Auth struct {
+	// HS256 key signing and checking user tokens, the service does not start without one
+	JWTSecret string `yaml:"jwt_secret"`
+}
+
+// minJWTSecret is the shortest accepted signing key, HS256 wants at least 256 bits
+const minJWTSecret = 32
+
+type Admin struct {
+	// Users allowed on the admin API, empty denies it to everyone
+	UserIDs []int `yaml:"user_ids"`
+}
+
+// Default return configuration used when nothing overrides it
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Addr:               ":8080",
+			Mode:               "release",
+			ReadTimeout:        15 * time.Second,
+			ReadHeaderTimeout:  5 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        2 * time.Minute,
+			DrainDelay:         5 * time.Second,
+			ShutdownTimeout:    30 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4317",
+			Insecure:    true,
+			ServiceName: "gw-currency-wallet",
+			SampleRatio: 1,
+		},
+		Database: Database{
+			Port:              5432,
+			SSLMode:           "disable",
+			AutoMigrate:       true,
+			MaxOpenConns:      25,
+			MaxIdleConns:      5,
+			ConnMaxLifetime:   30 * time.Minute,
+			ConnMaxIdleTime:   5 * time.Minute,
+			StatementTimeout:  30 * time.Second,
+			ConnectRetries:    10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 10 * time.Second,
+		},
+		Exchanger: Exchanger{
+			Addr:             "exchanger:50051",
+			CallTimeout:      2 * time.Second,
+			MaxRetries:       3,
+			BaseBackoff:      100 * time.Millisecond,
+			MaxBackoff:       2 * time.Second,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+			KeepaliveTime:    30 * time.Second,
+			KeepaliveTimeout: 10 * time.Second,
+			HealthCheck:      true,
+		},
+		Cache: Cache{
+			TTL:              5 * time.Minute,
+			CleanupInterval:  10 * time.Minute,
+			SnapshotPath:     "rates_snapshot.json",
+			SnapshotInterval: time.Minute,
+			WarmupTimeout:    10 * time.Second,
+			RatesMaxAge:      time.Minute,
+			HistoryInterval:  15 * time.Minute,
+		},
+		RateGuard: RateGuard{
+			MaxDeviation: 0.25,
+		},
+		Holds: Holds{
+			DefaultTTL:    15 * time.Minute,
+			MaxTTL:        7 * 24 * time.Hour,
+			SweepInterval: time.Minute,
+		},
+		Webhooks: Webhooks{
+			PollInterval: 2 * time.Second,
+			BatchSize:    100,
+			Workers:      4,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  10,
+			Backoff:      30 * time.Second,
+			MaxBackoff:   6 * time.Hour,
+		},
+		Reconcile: Reconcile{
+			Interval: time.Hour,
+			KeepRuns: 500,
+		},
+		Snapshots: Snapshots{
+			Interval: 15 * time.Minute,
+			Delay:    time.Hour,
+		},
+		Currencies: []string{"USD", "EUR", "RUB"},
+	}
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Validate check the configuration and return all problems at once
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.HTTP.Addr == "" {
+		fail("http.addr (HTTP_ADDR) is required")
+	}
+	switch c.HTTP.Mode {
+	case "debug", "release", "test":
+	default:
+		fail("http.mode (GIN_MODE) must be debug, release or test, got %q", c.HTTP.Mode)
+	}
+	if c.HTTP.ReadTimeout < 0 || c.HTTP.ReadHeaderTimeout < 0 || c.HTTP.WriteTimeout < 0 || c.HTTP.IdleTimeout < 0 {
+		fail("http timeouts must not be negative")
+	}
+	if c.HTTP.DrainDelay < 0 {
+		fail("http.drain_delay must not be negative")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		fail("http.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+	}
+	if c.HTTP.HealthCheckTimeout <= 0 {
+		fail("http.health_check_timeout must be positive")
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("log.level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		fail("log.format (LOG_FORMAT) must be json or text, got %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp-grpc", "otlp-http":
+		if c.Tracing.Endpoint == "" {
+			fail("tracing.endpoint (OTEL_EXPORTER_ENDPOINT) is required for %s", c.Tracing.Exporter)
+		}
+	default:
+		fail("tracing.exporter (TRACING_EXPORTER) must be none, stdout, otlp-grpc or otlp-http, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	// DATABASE_URL replaces the separate connection settings
+	if c.Database.URL == "" {
+		if c.Database.Host == "" {
+			fail("database.host (HOST_DB) or database.url (DATABASE_URL) is required")
+		}
+		if c.Database.Port <= 0 || c.Database.Port > 65535 {
+			fail("database.port (PORT_DB) must be a valid port, got %d", c.Database.Port)
+		}
+		if c.Database.User == "" {
+			fail("database.user (USERNAME_DB) is required")
+		}
+		if c.Database.Name == "" {
+			fail("database.name (DATABASE) is required")
+		}
+		if c.Database.SSLMode == "" {
+			fail("database.ssl_mode (SSL) is required")
+		}
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		fail("database.max_open_conns and database.max_idle_conns must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("database.max_idle_conns (DB_MAX_IDLE_CONNS) must not exceed database.max_open_conns (DB_MAX_OPEN_CONNS)")
+	}
+	if c.Database.StatementTimeout < 0 {
+		fail("database.statement_timeout (DB_STATEMENT_TIMEOUT) must not be negative")
+	}
+	if c.Database.ConnectRetries < 0 {
+		fail("database.connect_retries (DB_CONNECT_RETRIES) must not be negative")
+	}
+
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			fail("http.trusted_proxies (TRUSTED_PROXIES) entry %q must be an IP or CIDR", proxy)
+		}
+	}
+
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		fail("http.tls_cert_file (TLS_CERT_FILE) and http.tls_key_file (TLS_KEY_FILE) must be set together")
+	}
+
+	if c.Exchanger.Addr == "" {
+		fail("exchanger.addr (EXCHANGER_ADDR) is required")
+	}
+	if c.Exchanger.CallTimeout <= 0 {
+		fail("exchanger.call_timeout must be positive")
+	}
+	if c.Exchanger.MaxRetries < 0 {
+		fail("exchanger.max_retries must not be negative")
+	}
+	if c.Exchanger.BaseBackoff > c.Exchanger.MaxBackoff {
+		fail("exchanger.base_backoff must not exceed exchanger.max_backoff")
+	}
+	if c.Exchanger.BreakerThreshold > 0 && c.Exchanger.BreakerCooldown <= 0 {
+		fail("exchanger.breaker_cooldown must be positive when the breaker is enabled")
+	}
+
+	if (c.Exchanger.TLS.CertFile == "") != (c.Exchanger.TLS.KeyFile == "") {
+		fail("exchanger.tls.cert_file and exchanger.tls.key_file must be set together")
+	}
+	if !c.Exchanger.TLS.Enabled && (c.Exchanger.TLS.CAFile != "" || c.Exchanger.TLS.CertFile != "") {
+		fail("exchanger.tls files are set but exchanger.tls.enabled (EXCHANGER_TLS) is false")
+	}
+
+	if c.Cache.TTL <= 0 {
+		fail("cache.ttl (CACHE_TTL) must be positive")
+	}
+	if c.Cache.CleanupInterval <= 0 {
+		fail("cache.cleanup_interval must be positive")
+	}
+	if c.Cache.SnapshotPath != "" && c.Cache.SnapshotInterval <= 0 {
+		fail("cache.snapshot_interval must be positive when cache.snapshot_path is set")
+	}
+	if c.Cache.HistoryInterval < 0 {
+		fail("cache.history_interval (RATE_HISTORY_INTERVAL) must not be negative")
+	}
+
+	if c.RateGuard.MaxDeviation < 0 {
+		fail("rate_guard.max_deviation must not be negative")
+	}
+	for pair, d := range c.RateGuard.PairMaxDeviation {
+		if from, to, ok := strings.Cut(pair, "->"); !ok || !currencyCode.MatchString(from) || !currencyCode.MatchString(to) {
+			fail("rate_guard.pair_max_deviation key %q must look like USD->EUR", pair)
+		}
+		if d < 0 {
+			fail("rate_guard.pair_max_deviation for %s must not be negative", pair)
+		}
+	}
+
+	if c.Holds.DefaultTTL <= 0 || c.Holds.MaxTTL < c.Holds.DefaultTTL {
+		fail("holds.default_ttl (HOLD_DEFAULT_TTL) must be positive and not above holds.max_ttl (HOLD_MAX_TTL)")
+	}
+	if c.Holds.SweepInterval <= 0 {
+		fail("holds.sweep_interval (HOLD_SWEEP_INTERVAL) must be positive")
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 {
+		fail("webhooks.poll_interval (WEBHOOK_POLL_INTERVAL) and webhooks.timeout (WEBHOOK_TIMEOUT) must be positive")
+	}
+	if c.Webhooks.BatchSize <= 0 || c.Webhooks.Workers <= 0 || c.Webhooks.MaxAttempts <= 0 {
+		fail("webhooks.batch_size, webhooks.workers and webhooks.max_attempts must be positive")
+	}
+	if c.Webhooks.Backoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+		fail("webhooks.backoff (WEBHOOK_BACKOFF) must be positive and not above webhooks.max_backoff (WEBHOOK_MAX_BACKOFF)")
+	}
+	if c.Reconcile.Interval < 0 {
+		fail("reconciliation.interval (RECONCILE_INTERVAL) must not be negative")
+	}
+	if c.Reconcile.KeepRuns <= 0 {
+		fail("reconciliation.keep_runs (RECONCILE_KEEP_RUNS) must be positive")
+	}
+	if c.Snapshots.Interval < 0 || c.Snapshots.Delay <= 0 {
+		fail("balance_snapshots.interval (BALANCE_SNAPSHOT_INTERVAL) must not be negative and balance_snapshots.delay (BALANCE_SNAPSHOT_DELAY) must be positive")
+	}
+
+	switch {
+	case c.Auth.JWTSecret == "":
+		fail("auth.jwt_secret (JWT_SECRET) is required")
+	case len(c.Auth.JWTSecret) < minJWTSecret:
+		fail("auth.jwt_secret (JWT_SECRET) must be at least %d bytes, got %d", minJWTSecret, len(c.Auth.JWTSecret))
+	case strings.Count(c.Auth.JWTSecret, c.Auth.JWTSecret[:1]) == len(c.Auth.JWTSecret):
+		fail("auth.jwt_secret (JWT_SECRET) must not repeat a single character")
+	}
+
+	if len(c.Currencies) == 0 {
+		fail("currencies (CURRENCIES) must not be empty")
+	}
+	for _, currency := range c.Currencies {
+		if !currencyCode.MatchString(currency) {
+			fail("currency %q must be a three letter upper case code", currency)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig return defaults with the values that have none
+func validConfig() Config {
+	cfg := Default()
+	cfg.Database.Host = "db"
+	cfg.Database.User = "wallet"
+	cfg.Database.Name = "wallet"
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	return cfg
+}
+
+func TestValidateAcceptsDefaults(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := validConfig()
+	cfg.Database = Database{URL: "postgres://wallet@db/wallet", Port: 5432}
+	cfg.HTTP.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.10", "::1"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("database.url without host and trusted proxies: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		want   string
+		mutate func(*Config)
+	}{
+		{"http.addr (HTTP_ADDR) is required", func(c *Config) { c.HTTP.Addr = "" }},
+		{`http.mode (GIN_MODE) must be debug, release or test, got "prod"`, func(c *Config) { c.HTTP.Mode = "prod" }},
+		{"http timeouts must not be negative", func(c *Config) { c.HTTP.WriteTimeout = -time.Second }},
+		{"http.drain_delay must not be negative", func(c *Config) { c.HTTP.DrainDelay = -time.Second }},
+		{"http.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive", func(c *Config) { c.HTTP.ShutdownTimeout = 0 }},
+		{"http.health_check_timeout must be positive", func(c *Config) { c.HTTP.HealthCheckTimeout = 0 }},
+		{`http.trusted_proxies (TRUSTED_PROXIES) entry "proxy.local" must be an IP or CIDR`, func(c *Config) { c.HTTP.TrustedProxies = []string{"proxy.local"} }},
+		{"http.tls_cert_file (TLS_CERT_FILE) and http.tls_key_file (TLS_KEY_FILE) must be set together", func(c *Config) { c.HTTP.TLSCertFile = "cert.pem" }},
+		{`log.level (LOG_LEVEL) must be debug, info, warn or error, got "loud"`, func(c *Config) { c.Log.Level = "loud" }},
+		{`log.format (LOG_FORMAT) must be json or text, got "xml"`, func(c *Config) { c.Log.Format = "xml" }},
+		{"tracing.endpoint (OTEL_EXPORTER_ENDPOINT) is required for otlp-grpc", func(c *Config) { c.Tracing.Exporter, c.Tracing.Endpoint = "otlp-grpc", "" }},
+		{`tracing.exporter (TRACING_EXPORTER) must be none, stdout, otlp-grpc or otlp-http, got "zipkin"`, func(c *Config) { c.Tracing.Exporter = "zipkin" }},
+		{"tracing.sample_ratio must be between 0 and 1", func(c *Config) { c.Tracing.SampleRatio = 1.5 }},
+		{"database.host (HOST_DB) or database.url (DATABASE_URL) is required", func(c *Config) { c.Database.Host = "" }},
+		{"database.port (PORT_DB) must be a valid port, got 70000", func(c *Config) { c.Database.Port = 70000 }},
+		{"database.user (USERNAME_DB) is required", func(c *Config) { c.Database.User = "" }},
+		{"database.name (DATABASE) is required", func(c *Config) { c.Database.Name = "" }},
+		{"database.ssl_mode (SSL) is required", func(c *Config) { c.Database.SSLMode = "" }},
+		{"database.max_open_conns and database.max_idle_conns must not be negative", func(c *Config) { c.Database.MaxIdleConns = -1 }},
+		{"database.max_idle_conns (DB_MAX_IDLE_CONNS) must not exceed database.max_open_conns (DB_MAX_OPEN_CONNS)", func(c *Config) { c.Database.MaxIdleConns = 100 }},
+		{"database.statement_timeout (DB_STATEMENT_TIMEOUT) must not be negative", func(c *Config) { c.Database.StatementTimeout = -time.Second }},
+		{"database.connect_retries (DB_CONNECT_RETRIES) must not be negative", func(c *Config) { c.Database.ConnectRetries = -1 }},
+		{"exchanger.addr (EXCHANGER_ADDR) is required", func(c *Config) { c.Exchanger.Addr = "" }},
+		{"exchanger.call_timeout must be positive", func(c *Config) { c.Exchanger.CallTimeout = 0 }},
+		{"exchanger.max_retries must not be negative", func(c *Config) { c.Exchanger.MaxRetries = -1 }},
+		{"exchanger.base_backoff must not exceed exchanger.max_backoff", func(c *Config) { c.Exchanger.BaseBackoff = time.Hour }},
+		{"exchanger.breaker_cooldown must be positive when the breaker is enabled", func(c *Config) { c.Exchanger.BreakerCooldown = 0 }},
+		{"exchanger.tls.cert_file and exchanger.tls.key_file must be set together", func(c *Config) { c.Exchanger.TLS.Enabled, c.Exchanger.TLS.KeyFile = true, "client.key" }},
+		{"exchanger.tls files are set but exchanger.tls.enabled (EXCHANGER_TLS) is false", func(c *Config) { c.Exchanger.TLS.CAFile = "ca.pem" }},
+		{"cache.ttl (CACHE_TTL) must be positive", func(c *Config) { c.Cache.TTL = 0 }},
+		{"cache.cleanup_interval must be positive", func(c *Config) { c.Cache.CleanupInterval = 0 }},
+		{"cache.snapshot_interval must be positive when cache.snapshot_path is set", func(c *Config) { c.Cache.SnapshotInterval = 0 }},
+		{"cache.history_interval (RATE_HISTORY_INTERVAL) must not be negative", func(c *Config) { c.Cache.HistoryInterval = -time.Second }},
+		{"rate_guard.max_deviation must not be negative", func(c *Config) { c.RateGuard.MaxDeviation = -0.1 }},
+		{`rate_guard.pair_max_deviation key "USD-EUR" must look like USD->EUR`, func(c *Config) { c.RateGuard.PairMaxDeviation = map[string]float64{"USD-EUR": 0.1} }},
+		{"rate_guard.pair_max_deviation for USD->EUR must not be negative", func(c *Config) { c.RateGuard.PairMaxDeviation = map[string]float64{"USD->EUR": -0.1} }},
+		{"holds.default_ttl (HOLD_DEFAULT_TTL) must be positive and not above holds.max_ttl (HOLD_MAX_TTL)", func(c *Config) { c.Holds.MaxTTL = time.Minute }},
+		{"holds.sweep_interval (HOLD_SWEEP_INTERVAL) must be positive", func(c *Config) { c.Holds.SweepInterval = 0 }},
+		{"webhooks.poll_interval (WEBHOOK_POLL_INTERVAL) and webhooks.timeout (WEBHOOK_TIMEOUT) must be positive", func(c *Config) { c.Webhooks.Timeout = 0 }},
+		{"webhooks.batch_size, webhooks.workers and webhooks.max_attempts must be positive", func(c *Config) { c.Webhooks.Workers = 0 }},
+		{"webhooks.backoff (WEBHOOK_BACKOFF) must be positive and not above webhooks.max_backoff (WEBHOOK_MAX_BACKOFF)", func(c *Config) { c.Webhooks.MaxBackoff = time.Second }},
+		{"reconciliation.interval (RECONCILE_INTERVAL) must not be negative", func(c *Config) { c.Reconcile.Interval = -time.Second }},
+		{"reconciliation.keep_runs (RECONCILE_KEEP_RUNS) must be positive", func(c *Config) { c.Reconcile.KeepRuns = 0 }},
+		{"balance_snapshots.interval (BALANCE_SNAPSHOT_INTERVAL) must not be negative and balance_snapshots.delay (BALANCE_SNAPSHOT_DELAY) must be positive", func(c *Config) { c.Snapshots.Delay = 0 }},
+		{"auth.jwt_secret (JWT_SECRET) is required", func(c *Config) { c.Auth.JWTSecret = "" }},
+		{"auth.jwt_secret (JWT_SECRET) must be at least 32 bytes, got 6", func(c *Config) { c.Auth.JWTSecret = "secret" }},
+		{"auth.jwt_secret (JWT_SECRET) must not repeat a single character", func(c *Config) { c.Auth.JWTSecret = strings.Repeat("x", 40) }},
+		{"currencies (CURRENCIES) must not be empty", func(c *Config) { c.Currencies = nil }},
+		{`currency "usd" must be a three letter upper case code`, func(c *Config) { c.Currencies = []string{"usd"} }},
+	}
+	for _, tt := range tests {
+		cfg := validConfig()
+		tt.mutate(&cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate() = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := validConfig()
+	cfg.HTTP.Addr = ""
+	cfg.Cache.TTL = 0
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "http.addr") || !strings.Contains(err.Error(), "cache.ttl") {
+		t.Fatalf("Validate() = %v, want both problems", err)
+	}
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// field binds one config value to its environment variable and flag
+type field struct {
+	env   string
+	flag  string
+	usage string
+	set   func(string) error
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"HTTP_ADDR", "http.addr", "HTTP listen address", setString(&c.HTTP.Addr)},
+		{"GIN_MODE", "http.mode", "gin mode: debug, release or test", setString(&c.HTTP.Mode)},
+		{"HTTP_READ_TIMEOUT", "http.read-timeout", "HTTP read timeout", setDuration(&c.HTTP.ReadTimeout)},
+		{"HTTP_READ_HEADER_TIMEOUT", "http.read-header-timeout", "HTTP read header timeout", setDuration(&c.HTTP.ReadHeaderTimeout)},
+		{"HTTP_WRITE_TIMEOUT", "http.write-timeout", "HTTP write timeout", setDuration(&c.HTTP.WriteTimeout)},
+		{"HTTP_IDLE_TIMEOUT", "http.idle-timeout", "HTTP keep-alive idle timeout", setDuration(&c.HTTP.IdleTimeout)},
+		{"DRAIN_DELAY", "http.drain-delay", "time reported not ready before draining", setDuration(&c.HTTP.DrainDelay)},
+		{"SHUTDOWN_TIMEOUT", "http.shutdown-timeout", "graceful shutdown deadline", setDuration(&c.HTTP.ShutdownTimeout)},
+		{"TLS_CERT_FILE", "http.tls-cert", "HTTPS certificate file", setString(&c.HTTP.TLSCertFile)},
+		{"TLS_KEY_FILE", "http.tls-key", "HTTPS key file", setString(&c.HTTP.TLSKeyFile)},
+		{"TRUSTED_PROXIES", "http.trusted-proxies", "comma separated proxy IPs or CIDRs allowed to set X-Forwarded-For", setRawList(&c.HTTP.TrustedProxies)},
+		{"HEALTH_CHECK_TIMEOUT", "http.health-check-timeout", "timeout of each readiness check", setDuration(&c.HTTP.HealthCheckTimeout)},
+
+		{"LOG_LEVEL", "log.level", "log level: debug, info, warn or error", setString(&c.Log.Level)},
+		{"LOG_FORMAT", "log.format", "log format: json or text", setString(&c.Log.Format)},
+
+		{"TRACING_EXPORTER", "tracing.exporter", "trace exporter: none, stdout, otlp-grpc or otlp-http", setString(&c.Tracing.Exporter)},
+		{"OTEL_EXPORTER_ENDPOINT", "tracing.endpoint", "OTLP collector host:port", setString(&c.Tracing.Endpoint)},
+		{"OTEL_EXPORTER_INSECURE", "tracing.insecure", "send OTLP without TLS", setBool(&c.Tracing.Insecure)},
+		{"OTEL_SERVICE_NAME", "tracing.service-name", "service name in traces", setString(&c.Tracing.ServiceName)},
+		{"TRACING_SAMPLE_RATIO", "tracing.sample-ratio", "share of traces sampled, 0 to 1", setFloat(&c.Tracing.SampleRatio)},
+
+		{"DATABASE_URL", "db.url", "database DSN or postgres:// URL, replaces the separate db settings", setString(&c.Database.URL)},
+		{"HOST_DB", "db.host", "database host", setString(&c.Database.Host)},
+		{"PORT_DB", "db.port", "database port", setInt(&c.Database.Port)},
+		{"USERNAME_DB", "db.user", "database user", setString(&c.Database.User)},
+		{"PASSWORD_DB", "db.password", "database password", setString(&c.Database.Password)},
+		{"DATABASE", "db.name", "database name", setString(&c.Database.Name)},
+		{"SSL", "db.sslmode", "database sslmode", setString(&c.Database.SSLMode)},
+		{"MIGRATE_ON_START", "db.auto-migrate", "apply pending migrations on startup", setBool(&c.Database.AutoMigrate)},
+		{"DB_MAX_OPEN_CONNS", "db.max-open-conns", "maximum open connections, 0 is unlimited", setInt(&c.Database.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", "db.max-idle-conns", "maximum idle connections", setInt(&c.Database.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", "db.conn-max-lifetime", "maximum lifetime of a connection", setDuration(&c.Database.ConnMaxLifetime)},
+		{"DB_CONN_MAX_IDLE_TIME", "db.conn-max-idle-time", "maximum idle time of a connection", setDuration(&c.Database.ConnMaxIdleTime)},
+		{"DB_STATEMENT_TIMEOUT", "db.statement-timeout", "statement_timeout of every session, 0 disables it", setDuration(&c.Database.StatementTimeout)},
+		{"DB_CONNECT_RETRIES", "db.connect-retries", "startup connection retries", setInt(&c.Database.ConnectRetries)},
+		{"DB_CONNECT_BACKOFF", "db.connect-backoff", "first startup retry backoff", setDuration(&c.Database.ConnectBackoff)},
+		{"DB_CONNECT_MAX_BACKOFF", "db.connect-max-backoff", "maximum startup retry backoff", setDuration(&c.Database.ConnectMaxBackoff)},
+
+		{"EXCHANGER_ADDR", "exchanger.addr", "exchanger gRPC address", setString(&c.Exchanger.Addr)},
+		{"EXCHANGER_CALL_TIMEOUT", "exchanger.call-timeout", "timeout of one exchanger call", setDuration(&c.Exchanger.CallTimeout)},
+		{"EXCHANGER_MAX_RETRIES", "exchanger.max-retries", "retries of a failed exchanger call", setInt(&c.Exchanger.MaxRetries)},
+		{"EXCHANGER_BASE_BACKOFF", "exchanger.base-backoff", "first retry backoff", setDuration(&c.Exchanger.BaseBackoff)},
+		{"EXCHANGER_MAX_BACKOFF", "exchanger.max-backoff", "maximum retry backoff", setDuration(&c.Exchanger.MaxBackoff)},
+		{"EXCHANGER_BREAKER_THRESHOLD", "exchanger.breaker-threshold", "consecutive failures opening the breaker, 0 disables it", setInt(&c.Exchanger.BreakerThreshold)},
+		{"EXCHANGER_BREAKER_COOLDOWN", "exchanger.breaker-cooldown", "how long the breaker stays open", setDuration(&c.Exchanger.BreakerCooldown)},
+		{"EXCHANGER_KEEPALIVE_TIME", "exchanger.keepalive-time", "keepalive ping interval, 0 disables keepalive", setDuration(&c.Exchanger.KeepaliveTime)},
+		{"EXCHANGER_KEEPALIVE_TIMEOUT", "exchanger.keepalive-timeout", "keepalive ping timeout", setDuration(&c.Exchanger.KeepaliveTimeout)},
+		{"EXCHANGER_HEALTH_CHECK", "exchanger.health-check", "enable gRPC client-side health checking", setBool(&c.Exchanger.HealthCheck)},
+
+		{"EXCHANGER_TLS", "exchanger.tls", "connect to the exchanger over TLS", setBool(&c.Exchanger.TLS.Enabled)},
+		{"EXCHANGER_TLS_CA_FILE", "exchanger.tls-ca", "CA verifying the exchanger certificate", setString(&c.Exchanger.TLS.CAFile)},
+		{"EXCHANGER_TLS_CERT_FILE", "exchanger.tls-cert", "client certificate for mTLS", setString(&c.Exchanger.TLS.CertFile)},
+		{"EXCHANGER_TLS_KEY_FILE", "exchanger.tls-key", "client key for mTLS", setString(&c.Exchanger.TLS.KeyFile)},
+		{"EXCHANGER_TLS_SERVER_NAME", "exchanger.tls-server-name", "expected exchanger certificate name", setString(&c.Exchanger.TLS.ServerName)},
+
+		{"CACHE_TTL", "cache.ttl", "rate cache TTL", setDuration(&c.Cache.TTL)},
+		{"CACHE_CLEANUP_INTERVAL", "cache.cleanup-interval", "rate cache cleanup interval", setDuration(&c.Cache.CleanupInterval)},
+		{"CACHE_SNAPSHOT_PATH", "cache.snapshot-path", "rate cache snapshot file, empty disables snapshots", setString(&c.Cache.SnapshotPath)},
+		{"CACHE_SNAPSHOT_INTERVAL", "cache.snapshot-interval", "rate cache snapshot interval", setDuration(&c.Cache.SnapshotInterval)},
+		{"CACHE_WARMUP_TIMEOUT", "cache.warmup-timeout", "startup rate prefetch timeout", setDuration(&c.Cache.WarmupTimeout)},
+		{"RATES_MAX_AGE", "cache.rates-max-age", "Cache-Control max-age of the rates API", setDuration(&c.Cache.RatesMaxAge)},
+		{"RATE_HISTORY_INTERVAL", "cache.history-interval", "how often rates are recorded for historical valuations, 0 disables", setDuration(&c.Cache.HistoryInterval)},
+
+		{"RATE_MAX_DEVIATION", "rate-guard.max-deviation", "maximum deviation from the last accepted rate", setFloat(&c.RateGuard.MaxDeviation)},
+		{"RATE_PAIR_MAX_DEVIATION", "rate-guard.pair-max-deviation", "per pair deviation, e.g. USD->RUB=0.5,EUR->RUB=0.5", setFloatMap(&c.RateGuard.PairMaxDeviation)},
+
+		{"HOLD_DEFAULT_TTL", "holds.default-ttl", "expiry of a hold without explicit expires_in", setDuration(&c.Holds.DefaultTTL)},
+		{"HOLD_MAX_TTL", "holds.max-ttl", "longest allowed hold", setDuration(&c.Holds.MaxTTL)},
+		{"HOLD_SWEEP_INTERVAL", "holds.sweep-interval", "how often expired holds are released", setDuration(&c.Holds.SweepInterval)},
+
+		{"WEBHOOK_POLL_INTERVAL", "webhooks.poll-interval", "how often the webhook outbox is polled", setDuration(&c.Webhooks.PollInterval)},
+		{"WEBHOOK_BATCH_SIZE", "webhooks.batch-size", "events and deliveries handled per poll", setInt(&c.Webhooks.BatchSize)},
+		{"WEBHOOK_WORKERS", "webhooks.workers", "concurrent webhook deliveries", setInt(&c.Webhooks.Workers)},
+		{"WEBHOOK_TIMEOUT", "webhooks.timeout", "timeout of one webhook request", setDuration(&c.Webhooks.Timeout)},
+		{"WEBHOOK_MAX_ATTEMPTS", "webhooks.max-attempts", "attempts before a delivery is dead-lettered", setInt(&c.Webhooks.MaxAttempts)},
+		{"WEBHOOK_BACKOFF", "webhooks.backoff", "delay before the first retry, doubled after each failure", setDuration(&c.Webhooks.Backoff)},
+		{"WEBHOOK_MAX_BACKOFF", "webhooks.max-backoff", "longest delay between retries", setDuration(&c.Webhooks.MaxBackoff)},
+		{"WEBHOOK_ALLOW_PRIVATE_TARGETS", "webhooks.allow-private-targets", "allow webhooks to private and loopback addresses", setBool(&c.Webhooks.AllowPrivateTargets)},
+
+		{"RECONCILE_INTERVAL", "reconciliation.interval", "how often wallets are reconciled with the ledger, 0 disables", setDuration(&c.Reconcile.Interval)},
+		{"RECONCILE_KEEP_RUNS", "reconciliation.keep-runs", "reconciliation reports kept", setInt(&c.Reconcile.KeepRuns)},
+
+		{"BALANCE_SNAPSHOT_INTERVAL", "balance-snapshots.interval", "how often missing daily balance snapshots are taken, 0 disables", setDuration(&c.Snapshots.Interval)},
+		{"BALANCE_SNAPSHOT_DELAY", "balance-snapshots.delay", "how long after midnight its snapshot is taken", setDuration(&c.Snapshots.Delay)},
+
+		{"JWT_SECRET", "auth.jwt-secret", "key signing user tokens, at least 32 bytes", setString(&c.Auth.JWTSecret)},
+		{"ADMIN_USER_IDS", "admin.user-ids", "comma separated admin user ids", setIntList(&c.Admin.UserIDs)},
+		{"CURRENCIES", "currencies", "comma separated enabled currencies", setStringList(&c.Currencies)},
+	}
+}
+
+// Load resolve the configuration from defaults, the optional YAML file,
+// the optional env file, environment variables and command line flags, then validate it.
+// The YAML file comes from -config or CONFIG_FILE, the env file from -env-file or ENV_FILE.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	envFile := fs.String("env-file", os.Getenv("ENV_FILE"), "dotenv file loaded into the environment")
+
+	// Flags are applied last, so remember them until the other sources are read
+	type flagValue struct {
+		name  string
+		value string
+	}
+	var flagValues []flagValue
+	for _, f := range cfg.fields() {
+		name := f.flag
+		fs.Func(name, f.usage+" (env "+f.env+")", func(value string) error {
+			flagValues = append(flagValues, flagValue{name, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *configPath != "" {
+		if err := loadYAML(*configPath, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if *envFile != "" {
+		if err := godotenv.Load(*envFile); err != nil {
+			return Config{}, fmt.Errorf("failed to load env file %s: %w", *envFile, err)
+		}
+	}
+
+	fields := cfg.fields()
+	byFlag := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byFlag[f.flag] = f
+		if value, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(strings.TrimSpace(value)); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := byFlag[fv.name].set(fv.value); err != nil {
+			return Config{}, fmt.Errorf("invalid -%s: %w", fv.name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadYAML(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func setString(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func setInt(p *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func setFloat(p *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func setDuration(p *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func setStringList(p *[]string) func(string) error {
+	return func(s string) error {
+		var list []string
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, strings.ToUpper(part))
+			}
+		}
+		*p = list
+		return nil
+	}
+}
+
+// setRawList is setStringList keeping the case of the values
+func setRawList(p *[]string) func(string) error {
+	return func(s string) error {
+		var list []string
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+		*p = list
+		return nil
+	}
+}
+
+func setIntList(p *[]int) func(string) error {
+	return func(s string) error {
+		var list []int
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return err
+			}
+			list = append(list, v)
+		}
+		*p = list
+		return nil
+	}
+}
+
+func setFloatMap(p *map[string]float64) func(string) error {
+	return func(s string) error {
+		m := make(map[string]float64)
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(part, "=")
+			if !ok {
+				return fmt.Errorf("expected KEY=VALUE, got %q", part)
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return err
+			}
+			m[strings.ToUpper(strings.TrimSpace(key))] = v
+		}
+		*p = m
+		return nil
+	}
+}
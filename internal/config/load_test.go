@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateEnv unset every variable Load reads, they are restored when the test ends
+func isolateEnv(t *testing.T) {
+	t.Helper()
+
+	keys := []string{"CONFIG_FILE", "ENV_FILE"}
+	for _, f := range (&Config{}).fields() {
+		keys = append(keys, f.env)
+	}
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const requiredYAML = `
+database:
+  host: db
+  user: wallet
+  name: wallet
+auth:
+  jwt_secret: "0123456789abcdef0123456789abcdef"
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	isolateEnv(t)
+
+	configFile := writeFile(t, "config.yaml", requiredYAML+`
+http:
+  addr: ":1001"
+log:
+  level: debug
+  format: text
+cache:
+  ttl: 1m
+`)
+	envFile := writeFile(t, "wallet.env", "LOG_LEVEL=warn\nCACHE_TTL=2m\n")
+	t.Setenv("CACHE_TTL", "3m")
+	t.Setenv("HTTP_ADDR", ":1002")
+
+	cfg, err := Load([]string{"-config", configFile, "-env-file", envFile, "-http.addr", ":1003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTP.Addr != ":1003" {
+		t.Errorf("http.addr = %q, flags must win over env and YAML", cfg.HTTP.Addr)
+	}
+	if cfg.Cache.TTL != 3*time.Minute {
+		t.Errorf("cache.ttl = %v, env must win over the env file and YAML", cfg.Cache.TTL)
+	}
+	if cfg.Log.Level != "warn" {
+		t.Errorf("log.level = %q, the env file must win over YAML", cfg.Log.Level)
+	}
+	if cfg.Log.Format != "text" {
+		t.Errorf("log.format = %q, YAML must win over defaults", cfg.Log.Format)
+	}
+	if cfg.Holds.SweepInterval != Default().Holds.SweepInterval {
+		t.Errorf("holds.sweep_interval = %v, unset values must keep their default", cfg.Holds.SweepInterval)
+	}
+}
+
+func TestLoadFilesFromEnv(t *testing.T) {
+	isolateEnv(t)
+
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", requiredYAML))
+	t.Setenv("ENV_FILE", writeFile(t, "wallet.env", "CURRENCIES=usd, gbp\n"))
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Host != "db" || strings.Join(cfg.Currencies, ",") != "USD,GBP" {
+		t.Fatalf("config = %+v, want the files named by CONFIG_FILE and ENV_FILE applied", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown YAML key", yaml: "http:\n  adress: \":80\"\n", want: "failed to parse config file"},
+		{name: "bad env value", env: map[string]string{"CACHE_TTL": "soon"}, want: "invalid CACHE_TTL"},
+		{name: "bad flag value", args: []string{"-db.port", "five"}, want: "invalid -db.port"},
+		{name: "unknown flag", args: []string{"-no-such-flag"}, want: "flag provided but not defined"},
+		{name: "missing env file", args: []string{"-env-file", "/nonexistent/wallet.env"}, want: "failed to load env file"},
+		{name: "invalid result", env: map[string]string{"LOG_LEVEL": "loud"}, want: "log.level (LOG_LEVEL) must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := append([]string{"-config", writeFile(t, "config.yaml", requiredYAML+tt.yaml)}, tt.args...)
+
+			_, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package fakeexchanger
+
+import (
+	"context"
+	"net"
+
+	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1024 * 1024
+
+// Register add the fake exchanger and a SERVING health service to the gRPC server
+func Register(gs *grpc.Server, srv *Server) *health.Server {
+	proto_exchange.RegisterExchangeServiceServer(gs, srv)
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, hs)
+	return hs
+}
+
+// StartBufconn run the fake exchanger in-process over an in-memory listener.
+// The returned connection goes straight to it, stop shuts both down.
+// Extra dial options are appended, e.g. the wallet's changer.Dial options.
+func StartBufconn(srv *Server, opts ...grpc.DialOption) (conn *grpc.ClientConn, stop func(), err error) {
+	lis := bufconn.Listen(bufSize)
+	gs := grpc.NewServer()
+	Register(gs, srv)
+	go gs.Serve(lis)
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+
+	conn, err = grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		gs.Stop()
+		return nil, nil, err
+	}
+
+	stop = func() {
+		conn.Close()
+		gs.Stop()
+	}
+	return conn, stop, nil
+}
@@ -0,0 +1,148 @@
+package fakeexchanger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Modes of rate generation
+const (
+	ModeFixed      = "fixed"
+	ModeRandomWalk = "random_walk"
+)
+
+// Duration is time.Duration that reads "150ms" style strings from YAML and JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Behavior describes how the fake exchanger answers
+type Behavior struct {
+	// fixed or random_walk
+	Mode string `json:"mode" yaml:"mode"`
+	// Standard deviation of a random walk step, 0.001 is 0.1%
+	Volatility float64 `json:"volatility" yaml:"volatility"`
+	// Added to every call, plus a random part up to LatencyJitter
+	Latency       Duration `json:"latency" yaml:"latency"`
+	LatencyJitter Duration `json:"latency_jitter" yaml:"latency_jitter"`
+	// Share of calls failing with ErrorCode, from 0 to 1
+	ErrorRate float64 `json:"error_rate" yaml:"error_rate"`
+	// gRPC code name like "Unavailable" or "Internal"
+	ErrorCode string `json:"error_code" yaml:"error_code"`
+}
+
+// Phase is a scripted behavior active for Duration
+type Phase struct {
+	Behavior `yaml:",inline"`
+	Duration Duration `json:"duration" yaml:"duration"`
+}
+
+// Config of the fake exchanger
+type Config struct {
+	// Rates of every currency against one base currency, base itself is 1
+	Rates map[string]float64 `json:"rates" yaml:"rates"`
+	// Default behavior when no script is given
+	Behavior `yaml:",inline"`
+	// Phases are played in order and looped
+	Script []Phase `json:"script" yaml:"script"`
+}
+
+// DefaultConfig return fixed rates for the wallet's default currencies
+func DefaultConfig() Config {
+	return Config{
+		Rates: map[string]float64{
+			"USD": 1,
+			"EUR": 0.92,
+			"RUB": 98.5,
+		},
+		Behavior: Behavior{Mode: ModeFixed},
+	}
+}
+
+// LoadConfig read config from YAML or JSON file, chosen by extension
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	default:
+		err = yaml.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate check config values
+func (c Config) Validate() error {
+	if len(c.Rates) == 0 {
+		return fmt.Errorf("config must define at least one rate")
+	}
+	for currency, rate := range c.Rates {
+		if rate <= 0 {
+			return fmt.Errorf("rate of %s must be positive", currency)
+		}
+	}
+	behaviors := []Behavior{c.Behavior}
+	for i, p := range c.Script {
+		if p.Duration <= 0 {
+			return fmt.Errorf("script phase %d must have positive duration", i)
+		}
+		behaviors = append(behaviors, p.Behavior)
+	}
+	for _, b := range behaviors {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b Behavior) validate() error {
+	switch b.Mode {
+	case "", ModeFixed, ModeRandomWalk:
+	default:
+		return fmt.Errorf("unknown mode %q", b.Mode)
+	}
+	if b.ErrorRate < 0 || b.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if _, err := parseCode(b.ErrorCode); err != nil {
+		return err
+	}
+	return nil
+}
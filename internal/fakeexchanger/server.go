@@ -0,0 +1,178 @@
+package fakeexchanger
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server is a fake ExchangeServiceServer driven by Config
+type Server struct {
+	proto_exchange.UnimplementedExchangeServiceServer
+
+	mu      sync.Mutex
+	cfg     Config
+	rates   map[string]float64
+	started time.Time
+}
+
+// NewServer create fake exchanger from config
+func NewServer(cfg Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Server{started: time.Now()}
+	s.apply(cfg)
+	return s, nil
+}
+
+// SetConfig replace rates and behavior, resetting the script clock
+func (s *Server) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apply(cfg)
+	s.started = time.Now()
+	return nil
+}
+
+// SetRate override rate of one currency against the base
+func (s *Server) SetRate(currency string, rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rates[strings.ToUpper(currency)] = rate
+}
+
+// SetBehavior replace the default behavior and drop the script
+func (s *Server) SetBehavior(b Behavior) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.Behavior = b
+	s.cfg.Script = nil
+	return nil
+}
+
+func (s *Server) apply(cfg Config) {
+	s.cfg = cfg
+	s.rates = make(map[string]float64, len(cfg.Rates))
+	for currency, rate := range cfg.Rates {
+		s.rates[strings.ToUpper(currency)] = rate
+	}
+}
+
+// GetExchangeRates return all rates against the base currency
+func (s *Server) GetExchangeRates(ctx context.Context, _ *proto_exchange.Empty) (*proto_exchange.ExchangeRatesResponse, error) {
+	rates, err := s.serve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &proto_exchange.ExchangeRatesResponse{Rates: make(map[string]float32, len(rates))}
+	for currency, rate := range rates {
+		resp.Rates[currency] = float32(rate)
+	}
+	return resp, nil
+}
+
+// GetExchangeRateForCurrency return cross rate of the pair
+func (s *Server) GetExchangeRateForCurrency(ctx context.Context, req *proto_exchange.CurrencyRequest) (*proto_exchange.ExchangeRateResponse, error) {
+	rates, err := s.serve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, okFrom := rates[strings.ToUpper(req.GetFromCurrency())]
+	to, okTo := rates[strings.ToUpper(req.GetToCurrency())]
+	if !okFrom || !okTo {
+		return nil, status.Errorf(codes.NotFound, "unknown currency pair %s->%s", req.GetFromCurrency(), req.GetToCurrency())
+	}
+
+	return &proto_exchange.ExchangeRateResponse{
+		FromCurrency: req.GetFromCurrency(),
+		ToCurrency:   req.GetToCurrency(),
+		Rate:         float32(to / from),
+	}, nil
+}
+
+// serve applies the active behavior and return a copy of the rates
+func (s *Server) serve(ctx context.Context) (map[string]float64, error) {
+	s.mu.Lock()
+	b := s.behavior(time.Since(s.started))
+	if b.Mode == ModeRandomWalk {
+		for currency, rate := range s.rates {
+			s.rates[currency] = rate * math.Exp(rand.NormFloat64()*b.Volatility)
+		}
+	}
+	rates := make(map[string]float64, len(s.rates))
+	for currency, rate := range s.rates {
+		rates[currency] = rate
+	}
+	s.mu.Unlock()
+
+	if delay := time.Duration(b.Latency) + jitter(time.Duration(b.LatencyJitter)); delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if b.ErrorRate > 0 && rand.Float64() < b.ErrorRate {
+		code, _ := parseCode(b.ErrorCode)
+		return nil, status.Error(code, "injected failure")
+	}
+	return rates, nil
+}
+
+// behavior return the scripted phase active at elapsed, or the default behavior
+func (s *Server) behavior(elapsed time.Duration) Behavior {
+	if len(s.cfg.Script) == 0 {
+		return s.cfg.Behavior
+	}
+
+	var total time.Duration
+	for _, p := range s.cfg.Script {
+		total += time.Duration(p.Duration)
+	}
+	elapsed %= total
+	for _, p := range s.cfg.Script {
+		if elapsed < time.Duration(p.Duration) {
+			return p.Behavior
+		}
+		elapsed -= time.Duration(p.Duration)
+	}
+	return s.cfg.Behavior
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(max)))
+}
+
+// parseCode map gRPC code name to code, empty name is Unavailable
+func parseCode(name string) (codes.Code, error) {
+	if name == "" {
+		return codes.Unavailable, nil
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(c.String(), name) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gRPC code %q", name)
+}
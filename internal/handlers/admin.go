@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gw-currncy-wallet/internal/apperr"
+	exchanger "gw-currncy-wallet/internal/changer"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminService struct {
+	exchanger *exchanger.ExchangerClient
+}
+
+type AcknowledgeHaltRequest struct {
+	AcceptRate bool `json:"accept_rate"` // Принять отклонённый курс как новый опорный
+}
+
+// NewAdminService create new admin service
+func NewAdminService(exchanger *exchanger.ExchangerClient) *AdminService {
+	return &AdminService{exchanger: exchanger}
+}
+
+// ListHaltsHandler godoc
+// @Summary      List halted currency pairs
+// @Description  Pairs where the rate guard rejected a quote and trading is stopped until acknowledged
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200  {object}  map[string][]changer.Halt
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Router       /api/v1/admin/rates/halts [get]
+func (s *AdminService) ListHaltsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"halts": s.exchanger.Guard().Halts()})
+}
+
+// AcknowledgeHaltHandler godoc
+// @Summary      Acknowledge halted currency pair
+// @Description  Resume trading on a pair halted by the rate guard, optionally accepting the rejected rate
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        from path string true "From currency"
+// @Param        to path string true "To currency"
+//
+//	@Param       input body AcknowledgeHaltRequest false "Acknowledge options"
+//
+// @Success      200  {object}  map[string]interface{} "Pair resumed"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "Pair is not halted"
+// @Router       /api/v1/admin/rates/halts/{from}/{to}/ack [post]
+func (s *AdminService) AcknowledgeHaltHandler(c *gin.Context) {
+	var req AcknowledgeHaltRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(invalidBody(err))
+			return
+		}
+	}
+
+	from := strings.ToUpper(c.Param("from"))
+	to := strings.ToUpper(c.Param("to"))
+	halt, err := s.exchanger.Guard().Acknowledge(c.Request.Context(), from, to, req.AcceptRate)
+	switch {
+	case errors.Is(err, exchanger.ErrInvalidRate):
+		// The rejected quote itself is unusable, that is a bad request and not an outage
+		c.Error(apperr.Invalid("%v", err))
+		return
+	case err != nil:
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pair resumed", "halt": halt, "accept_rate": req.AcceptRate})
+}
+
+// ExchangerStatsHandler godoc
+// @Summary      Exchanger client stats
+// @Description  Call, retry and failure counters and circuit breaker state of the exchanger client
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200  {object}  changer.ClientStats
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Router       /api/v1/admin/exchanger/stats [get]
+func (s *AdminService) ExchangerStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.exchanger.Stats())
+}
+
+// InvalidateRateHandler godoc
+// @Summary      Invalidate cached rate
+// @Description  Drop a currency pair from the rate cache, the next request fetches a fresh quote
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        from path string true "From currency"
+// @Param        to path string true "To currency"
+// @Success      200  {object}  map[string]string "Rate invalidated"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Router       /api/v1/admin/rates/cache/{from}/{to} [delete]
+func (s *AdminService) InvalidateRateHandler(c *gin.Context) {
+	from := strings.ToUpper(c.Param("from"))
+	to := strings.ToUpper(c.Param("to"))
+	s.exchanger.InvalidateRate(from, to)
+	c.JSON(http.StatusOK, gin.H{"message": "Rate invalidated", "from_currency": from, "to_currency": to})
+}
+
+// InvalidateRatesHandler godoc
+// @Summary      Invalidate rate cache
+// @Description  Drop all cached rates
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200  {object}  map[string]string "Rate cache invalidated"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Router       /api/v1/admin/rates/cache [delete]
+func (s *AdminService) InvalidateRatesHandler(c *gin.Context) {
+	s.exchanger.InvalidateRates()
+	c.JSON(http.StatusOK, gin.H{"message": "Rate cache invalidated"})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditService struct {
+	db *postgres.StorageConn
+}
+
+type AuditResponse struct {
+	Entries []postgres.AuditEntry `json:"entries"`
+	// Pass as before_id to get the next page, absent on the last page
+	NextBeforeID int64 `json:"next_before_id,omitempty"`
+}
+
+// NewAuditService create audit log service
+func NewAuditService(db *postgres.StorageConn) *AuditService {
+	return &AuditService{db: db}
+}
+
+// AdminAuditMiddleware log every state changing admin request, including the refused ones,
+// so it runs before AdminMiddleware. Reads are not logged.
+func AdminAuditMiddleware(db *postgres.StorageConn) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		status := c.Writer.Status()
+		details := map[string]any{
+			"method": c.Request.Method,
+			"route":  c.FullPath(),
+			"path":   c.Request.URL.Path,
+		}
+		if len(c.Errors) > 0 {
+			// The error middleware writes the response after us
+			var code string
+			status, code, _ = apperr.Public(c.Errors.Last().Err)
+			details["error"] = code
+		}
+		details["status"] = status
+		if len(c.Params) > 0 {
+			params := make(map[string]string, len(c.Params))
+			for _, p := range c.Params {
+				params[p.Key] = p.Value
+			}
+			details["params"] = params
+		}
+
+		err := db.Audit(c.Request.Context(), postgres.AuditRecord{Action: postgres.AuditAdminRequest, Details: details})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to audit admin request", "error", err)
+		}
+	}
+}
+
+// AuditLogHandler godoc
+// @Summary      Query audit log
+// @Description  Audit entries newest first. Every entry carries the hash of the previous one, walletctl audit verify checks the chain.
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        actor_id query int false "Who did it"
+// @Param        user_id query int false "Whose account is affected"
+// @Param        action query string false "Action, for example login.failed or wallet.withdrawal"
+// @Param        request_id query string false "Request ID"
+// @Param        from query string false "Start of the period, YYYY-MM-DD or RFC 3339"
+// @Param        to query string false "End of the period, exclusive, a date includes the whole day"
+// @Param        before_id query int false "Only entries older than this id"
+// @Param        limit query int false "Maximum number of entries" default(100)
+// @Success      200  {object}  AuditResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/audit [get]
+func (s *AuditService) AuditLogHandler(c *gin.Context) {
+	filter := postgres.AuditFilter{
+		Action:    c.Query("action"),
+		RequestID: c.Query("request_id"),
+	}
+
+	var err error
+	if filter.ActorID, err = queryInt(c, "actor_id"); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.UserID, err = queryInt(c, "user_id"); err != nil {
+		c.Error(err)
+		return
+	}
+	beforeID, err := queryInt(c, "before_id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filter.BeforeID = int64(beforeID)
+	if filter.From, err = periodBound(c.Query("from"), false, time.Time{}); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.To, err = periodBound(c.Query("to"), true, time.Time{}); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.Limit, err = queryLimit(c, 100, 1000); err != nil {
+		c.Error(err)
+		return
+	}
+
+	entries, err := s.db.AuditLog(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	resp := AuditResponse{Entries: entries}
+	if len(entries) == filter.Limit {
+		resp.NextBeforeID = entries[len(entries)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// queryInt parse optional positive integer query parameter, absent is 0
+func queryInt(c *gin.Context, name string) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		return 0, apperr.Invalid("%s must be a positive integer", name)
+	}
+	return v, nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse is the envelope of every API error
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string `json:"code" example:"insufficient_funds"`
+	Message   string `json:"message" example:"insufficient funds on balance"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ErrorMiddleware render the last error added with c.Error as ErrorResponse.
+// Errors which are not domain errors become 500 internal_error, their text only goes to the logs.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		status, code, message := apperr.Public(c.Errors.Last().Err)
+		c.JSON(status, ErrorResponse{Error: ErrorBody{
+			Code:      code,
+			Message:   message,
+			RequestID: logging.RequestID(c.Request.Context()),
+		}})
+	}
+}
+
+// invalidBody wrap a binding error so the client sees which field is wrong
+func invalidBody(err error) error {
+	return apperr.Invalid("invalid request body: %v", err)
+}
+
+// userID return the authenticated user, set by JWTMiddleware
+func userID(c *gin.Context) (int, bool) {
+	id, exists := c.Get("user_id")
+	if !exists {
+		c.Error(apperr.ErrUnauthorized)
+		return 0, false
+	}
+	return id.(int), true
+}
+
+// NotFoundHandler answer unknown routes with the error envelope
+func NotFoundHandler(c *gin.Context) {
+	c.Error(apperr.New(apperr.CodeNotFound, http.StatusNotFound, "route not found"))
+}
@@ -2,11 +2,18 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"gw-currncy-wallet/internal/apperr"
 	exchanger "gw-currncy-wallet/internal/changer"
+	"gw-currncy-wallet/internal/metrics"
 	postgres "gw-currncy-wallet/internal/storages/postgres"
+	"gw-currncy-wallet/internal/tracing"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WalletService struct {
@@ -15,9 +22,10 @@ type WalletService struct {
 }
 
 type ExchangeRequest struct {
-	FromCurrency string  `json:"from_currency" binding:"required"` // Исходная валюта
-	ToCurrency   string  `json:"to_currency" binding:"required"`   // Целевая валюта
-	Amount       float64 `json:"amount" binding:"required,gt=0"`   // Сумма для обмена
+	FromCurrency string  `json:"from_currency" binding:"required"`   // Исходная валюта
+	ToCurrency   string  `json:"to_currency" binding:"required"`     // Целевая валюта
+	Amount       float64 `json:"amount" binding:"required,gt=0"`     // Сумма для обмена
+	PocketID     int64   `json:"pocket_id" binding:"omitempty,gt=0"` // Карман, по умолчанию основной
 }
 
 // NewWalletService create new wallet service
@@ -39,78 +47,85 @@ func NewWalletService(db *postgres.StorageConn, exchanger *exchanger.ExchangerCl
 //	@Param       input body ExchangeRequest true "Exchange information"
 //
 // @Success      200  {object}  map[string]string "Exchange successful"
-// @Failure      401  {object}  map[string]string "Unauthorized"
-// @Failure      400  {object}  map[string]string "Invalid input"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      422  {object}  ErrorResponse "Insufficient funds"
+// @Failure      503  {object}  ErrorResponse "Exchange rate unavailable"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
 // @Router       /api/v1/wallet/exchange [post]
 func (s *WalletService) ExchangeHandler(c *gin.Context) {
 	var req struct {
 		FromCurrency string  `json:"from_currency" binding:"required"`
 		ToCurrency   string  `json:"to_currency" binding:"required"`
 		Amount       float64 `json:"amount" binding:"required,gt=0"`
+		PocketID     int64   `json:"pocket_id" binding:"omitempty,gt=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	from, err := s.currency(req.FromCurrency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	to, err := s.currency(req.ToCurrency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if from == to {
+		c.Error(apperr.Invalid("currencies must differ"))
 		return
 	}
 
 	ctx := c.Request.Context()
-	err := s.Exchange(ctx, userID.(int), req.FromCurrency, req.ToCurrency, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.Exchange(ctx, userID, req.PocketID, from, to, req.Amount); err != nil {
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Exchange successful"})
 }
 
-func (s *WalletService) Exchange(ctx context.Context, userID int, fromCurrency, toCurrency string, amount float64) error {
-	exchangeRate, err := s.exchanger.GetExchangeRate(ctx, fromCurrency, toCurrency)
-	if err != nil {
-		return err
-	}
-
-	tx, err := s.db.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
+func (s *WalletService) Exchange(ctx context.Context, userID int, pocketID int64, fromCurrency, toCurrency string, amount float64) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "WalletService.Exchange", trace.WithAttributes(
+		attribute.Int("user.id", userID),
+		attribute.Int64("pocket.id", pocketID),
+		attribute.String("currency.from", fromCurrency),
+		attribute.String("currency.to", toCurrency),
+		attribute.Float64("amount", amount),
+	))
 	defer func() {
 		if err != nil {
-			tx.Rollback()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
 	}()
 
-	withdrawQuery := `
-		UPDATE wallet
-		SET amount = amount - $1
-		WHERE user_id = $2 AND currency = $3 AND amount >= $1;
-	`
-	_, err = tx.ExecContext(ctx, withdrawQuery, amount, userID, fromCurrency)
+	exchangeRate, err := s.exchanger.GetExchangeRate(ctx, fromCurrency, toCurrency)
 	if err != nil {
 		return err
 	}
 
-	toAmount := amount * exchangeRate
-	depositQuery := `
-		UPDATE wallet
-		SET amount = amount + $1
-		WHERE user_id = $2 AND currency = $3;
-	`
-	_, err = tx.ExecContext(ctx, depositQuery, toAmount, userID, toCurrency)
+	toAmount, err := s.db.Exchange(ctx, userID, pocketID, fromCurrency, toCurrency, amount, exchangeRate)
 	if err != nil {
+		if errors.Is(err, apperr.ErrInsufficientFunds) {
+			metrics.InsufficientFunds("exchange", fromCurrency)
+		}
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
+	metrics.Operation("exchange_out", fromCurrency, amount)
+	metrics.Operation("exchange_in", toCurrency, toAmount)
 	return nil
 }
@@ -1,7 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,39 +18,127 @@ import (
 type DepositRequest struct {
 	Currency string  `json:"currency" binding:"required"`
 	Amount   float64 `json:"amount" binding:"required,gt=0"`
+	PocketID int64   `json:"pocket_id" binding:"omitempty,gt=0"` // Карман, по умолчанию основной
 }
 
 type WithdrawRequest struct {
 	Currency string  `json:"currency" binding:"required"`
 	Amount   float64 `json:"amount" binding:"required,gt=0"`
+	PocketID int64   `json:"pocket_id" binding:"omitempty,gt=0"` // Карман, по умолчанию основной
+}
+
+type BalanceResponse struct {
+	Balances map[string]postgres.Balance `json:"balances"`
+	// Set when the balances are historical
+	AsOf *time.Time `json:"as_of,omitempty"`
+	// Set when a valuation currency is asked
+	Valuation *Valuation `json:"valuation,omitempty"`
+}
+
+// currency normalize the currency code and check it is enabled
+func (s *WalletService) currency(code string) (string, error) {
+	return enabledCurrency(s.db.Currencies, code)
+}
+
+func enabledCurrency(currencies []string, code string) (string, error) {
+	code = strings.ToUpper(code)
+	if !slices.Contains(currencies, code) {
+		return "", fmt.Errorf("%w: %s", apperr.ErrUnknownCurrency, code)
+	}
+	return code, nil
 }
 
 // GetBalanceHandler godoc
 // @Summary      Get wallet balance
-// @Description  Retrieve the balance of the user's wallet in all available currencies
+// @Description  Retrieve total, available and held balance of the user's wallet in all currencies. Without pocket_id the default pocket is shown.
+// @Description  as_of returns the balances as they were at that moment, rebuilt from the movement history.
+// @Description  valuation converts every total into one currency with a grand total, current balances at live rates, historical ones at the rates recorded then.
 // @Tags         Wallet
 // @Accept       json
 // @Produce      json
 // @Param        Authorization header string true "Bearer token"
-// @Success      200  {object}  map[string]float64
-// @Failure      401  {object}  map[string]string "Unauthorized"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Param        pocket_id query int false "Pocket ID"
+// @Param        as_of query string false "RFC 3339 moment in the past, for example 2026-03-31T23:59:59Z"
+// @Param        valuation query string false "Valuation currency, for example USD"
+// @Success      200  {object}  BalanceResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Failure      503  {object}  ErrorResponse "Rate unavailable"
 // @Router       /api/v1/balance [get]
 func (s *WalletService) GetBalanceHandler(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	s.balance(c, userID)
+}
+
+// AdminBalanceHandler godoc
+// @Summary      Get user balance
+// @Description  Balance of any user's pocket, current or as of a past moment
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "User ID"
+// @Param        pocket_id query int false "Pocket ID"
+// @Param        as_of query string false "RFC 3339 moment in the past, for example 2026-03-31T23:59:59Z"
+// @Param        valuation query string false "Valuation currency, for example USD"
+// @Success      200  {object}  BalanceResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "User or pocket not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Failure      503  {object}  ErrorResponse "Rate unavailable"
+// @Router       /api/v1/admin/users/{id}/balance [get]
+func (s *WalletService) AdminBalanceHandler(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	s.balance(c, int(id))
+}
+
+// balance answer with current balances of the pocket in ?pocket_id, or historical ones with ?as_of,
+// valued in the currency in ?valuation
+func (s *WalletService) balance(c *gin.Context, userID int) {
+	pocketID, err := queryPocketID(c)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	ctx := c.Request.Context()
-	balances, err := s.db.GetBalance(ctx, userID.(int))
+	var resp BalanceResponse
+	if raw := c.Query("as_of"); raw == "" {
+		resp.Balances, err = s.db.GetBalance(ctx, userID, pocketID)
+	} else {
+		asOf, parseErr := time.Parse(time.RFC3339, raw)
+		if parseErr != nil {
+			c.Error(apperr.Invalid("as_of must be an RFC 3339 time like 2026-03-31T23:59:59Z"))
+			return
+		}
+		if asOf.After(time.Now()) {
+			c.Error(apperr.Invalid("as_of must not be in the future"))
+			return
+		}
+		asOf = asOf.UTC()
+		resp.AsOf = &asOf
+		resp.Balances, err = s.db.BalanceAsOf(ctx, userID, pocketID, asOf)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance", "details": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"balances": balances})
+	if resp.Valuation, err = s.valuation(ctx, c.Query("valuation"), resp.Balances, resp.AsOf); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // DepositHandler godoc
@@ -55,34 +152,41 @@ func (s *WalletService) GetBalanceHandler(c *gin.Context) {
 //	@Param       input body DepositRequest true "Deposit information"
 //
 // @Success      200  {object}  map[string]string "Deposit successful"
-// @Failure      401  {object}  map[string]string "Unauthorized"
-// @Failure      400  {object}  map[string]string "Invalid input"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
 // @Router       /api/v1/wallet/deposit [post]
 func (s *WalletService) DepositHandler(c *gin.Context) {
 	var req struct {
 		Currency string  `json:"currency" binding:"required"`
 		Amount   float64 `json:"amount" binding:"required,gt=0"`
+		PocketID int64   `json:"pocket_id" binding:"omitempty,gt=0"`
 	}
 
 	// Парсим тело запроса
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	currency, err := s.currency(req.Currency)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	ctx := c.Request.Context()
-	err := s.db.BalanceReplenishment(ctx, userID.(int), req.Currency, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deposit", "details": err.Error()})
+	if err := s.db.BalanceReplenishment(ctx, userID, req.PocketID, currency, req.Amount); err != nil {
+		c.Error(err)
 		return
 	}
+	metrics.Operation("deposit", currency, req.Amount)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Deposit successful"})
 }
@@ -98,33 +202,44 @@ func (s *WalletService) DepositHandler(c *gin.Context) {
 //	@Param       input body WithdrawRequest true "Withdrawal information"
 //
 // @Success      200  {object}  map[string]string "Withdrawal successful"
-// @Failure      401  {object}  map[string]string "Unauthorized"
-// @Failure      400  {object}  map[string]string "Invalid input"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      422  {object}  ErrorResponse "Insufficient funds"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
 // @Router       /api/v1/wallet/withdraw [post]
 func (s *WalletService) WithdrawHandler(c *gin.Context) {
 	var req struct {
 		Currency string  `json:"currency" binding:"required"`
 		Amount   float64 `json:"amount" binding:"required,gt=0"`
+		PocketID int64   `json:"pocket_id" binding:"omitempty,gt=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	currency, err := s.currency(req.Currency)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	ctx := c.Request.Context()
-	err := s.db.BalanceWithdraw(ctx, userID.(int), req.Currency, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw", "details": err.Error()})
+	if err := s.db.BalanceWithdraw(ctx, userID, req.PocketID, currency, req.Amount); err != nil {
+		if errors.Is(err, apperr.ErrInsufficientFunds) {
+			metrics.InsufficientFunds("withdraw", currency)
+		}
+		c.Error(err)
 		return
 	}
+	metrics.Operation("withdraw", currency, req.Amount)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal successful"})
 }
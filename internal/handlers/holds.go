@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HoldService struct {
+	db         *postgres.StorageConn
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+type PlaceHoldRequest struct {
+	Currency    string  `json:"currency" binding:"required"`
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	ExpiresIn   int     `json:"expires_in" binding:"omitempty,gt=0"` // Срок жизни в секундах, по умолчанию из конфигурации
+	Description string  `json:"description" binding:"max=255"`
+	PocketID    int64   `json:"pocket_id" binding:"omitempty,gt=0"` // Карман, по умолчанию основной
+}
+
+type CaptureHoldRequest struct {
+	Amount float64 `json:"amount" binding:"omitempty,gt=0"` // Сумма списания, по умолчанию вся сумма холда
+}
+
+type CaptureHoldResponse struct {
+	Hold        postgres.Hold        `json:"hold"`
+	Transaction postgres.Transaction `json:"transaction"`
+}
+
+type HoldsResponse struct {
+	Holds []postgres.Hold `json:"holds"`
+}
+
+// NewHoldService create new hold service, holds without expires_in live defaultTTL
+func NewHoldService(db *postgres.StorageConn, defaultTTL, maxTTL time.Duration) *HoldService {
+	return &HoldService{
+		db:         db,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// PlaceHoldHandler godoc
+// @Summary      Reserve funds
+// @Description  Place a hold on an amount of the wallet. Held funds are not available for withdrawals and exchanges until the hold is captured, released or expires.
+// @Tags         Holds
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+//
+//	@Param       input body PlaceHoldRequest true "Hold information"
+//
+// @Success      201  {object}  postgres.Hold
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      422  {object}  ErrorResponse "Insufficient funds"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/wallet/holds [post]
+func (s *HoldService) PlaceHoldHandler(c *gin.Context) {
+	var req PlaceHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	currency, err := enabledCurrency(s.db.Currencies, req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ttl := s.defaultTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > s.maxTTL {
+		c.Error(apperr.Invalid("expires_in must not exceed %d seconds", int(s.maxTTL.Seconds())))
+		return
+	}
+
+	hold, err := s.db.PlaceHold(c.Request.Context(), userID, req.PocketID, currency, req.Amount, time.Now().Add(ttl), req.Description)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	metrics.Operation("hold", currency, hold.Amount)
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// ListHoldsHandler godoc
+// @Summary      List holds
+// @Description  Holds of the user, newest first
+// @Tags         Holds
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        status query string false "Filter by status" Enums(active, captured, released, expired)
+// @Param        limit query int false "Maximum number of holds" default(50)
+// @Success      200  {object}  HoldsResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/wallet/holds [get]
+func (s *HoldService) ListHoldsHandler(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", postgres.HoldActive, postgres.HoldCaptured, postgres.HoldReleased, postgres.HoldExpired:
+	default:
+		c.Error(apperr.Invalid("unknown hold status %q", status))
+		return
+	}
+	limit, err := queryLimit(c, 50, 500)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	holds, err := s.db.Holds(c.Request.Context(), userID, status, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, HoldsResponse{Holds: holds})
+}
+
+// CaptureHoldHandler godoc
+// @Summary      Capture hold
+// @Description  Debit held funds. Without amount the whole hold is captured, a smaller amount captures part and releases the rest.
+// @Tags         Holds
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Hold ID"
+//
+//	@Param       input body CaptureHoldRequest false "Capture amount"
+//
+// @Success      200  {object}  CaptureHoldResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Hold not found"
+// @Failure      409  {object}  ErrorResponse "Hold is no longer active"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/wallet/holds/{id}/capture [post]
+func (s *HoldService) CaptureHoldHandler(c *gin.Context) {
+	var req CaptureHoldRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(invalidBody(err))
+			return
+		}
+	}
+
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	holdID, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	hold, t, err := s.db.CaptureHold(c.Request.Context(), userID, holdID, req.Amount)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	metrics.Operation("capture", hold.Currency, hold.Captured)
+
+	c.JSON(http.StatusOK, CaptureHoldResponse{Hold: *hold, Transaction: *t})
+}
+
+// ReleaseHoldHandler godoc
+// @Summary      Release hold
+// @Description  Cancel an active hold, its funds become available again
+// @Tags         Holds
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Hold ID"
+// @Success      200  {object}  postgres.Hold
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Hold not found"
+// @Failure      409  {object}  ErrorResponse "Hold is no longer active"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/wallet/holds/{id}/release [post]
+func (s *HoldService) ReleaseHoldHandler(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	holdID, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	hold, err := s.db.ReleaseHold(c.Request.Context(), userID, holdID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	metrics.Operation("release", hold.Currency, hold.Amount)
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// pathID parse positive integer path parameter
+func pathID(c *gin.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apperr.Invalid("%s must be a positive integer", name)
+	}
+	return id, nil
+}
+
+// queryLimit parse optional limit query parameter
+func queryLimit(c *gin.Context, def, max int) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > max {
+		return 0, apperr.Invalid("limit must be between 1 and %d", max)
+	}
+	return limit, nil
+}
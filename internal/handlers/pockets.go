@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreatePocketRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+type TransferRequest struct {
+	FromPocketID int64   `json:"from_pocket_id" binding:"omitempty,gt=0"` // Карман списания, по умолчанию основной
+	ToPocketID   int64   `json:"to_pocket_id" binding:"omitempty,gt=0"`   // Карман зачисления, по умолчанию основной
+	Currency     string  `json:"currency" binding:"required"`
+	Amount       float64 `json:"amount" binding:"required,gt=0"`
+}
+
+type PocketsResponse struct {
+	Pockets []postgres.Pocket `json:"pockets"`
+}
+
+type TransferResponse struct {
+	Transactions []postgres.Transaction `json:"transactions"`
+}
+
+// CreatePocketHandler godoc
+// @Summary      Create pocket
+// @Description  Add a named pocket with an empty wallet in every currency
+// @Tags         Pockets
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+//
+//	@Param       input body CreatePocketRequest true "Pocket information"
+//
+// @Success      201  {object}  postgres.Pocket
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      409  {object}  ErrorResponse "Pocket already exists"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/pockets [post]
+func (s *WalletService) CreatePocketHandler(c *gin.Context) {
+	var req CreatePocketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.Error(apperr.Invalid("pocket name must not be empty"))
+		return
+	}
+
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+
+	pocket, err := s.db.CreatePocket(c.Request.Context(), userID, name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, pocket)
+}
+
+// ListPocketsHandler godoc
+// @Summary      List pockets
+// @Description  Pockets of the user with their balances, the default pocket first
+// @Tags         Pockets
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200  {object}  PocketsResponse
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/pockets [get]
+func (s *WalletService) ListPocketsHandler(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+
+	pockets, err := s.db.Pockets(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, PocketsResponse{Pockets: pockets})
+}
+
+// TransferHandler godoc
+// @Summary      Move funds between pockets
+// @Description  Move an amount of one currency between two pockets of the user. Transfers are free and keep the currency.
+// @Tags         Pockets
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+//
+//	@Param       input body TransferRequest true "Transfer information"
+//
+// @Success      200  {object}  TransferResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Account is frozen"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      422  {object}  ErrorResponse "Insufficient funds"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/pockets/transfer [post]
+func (s *WalletService) TransferHandler(c *gin.Context) {
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	currency, err := s.currency(req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	txs, err := s.db.Transfer(c.Request.Context(), userID, req.FromPocketID, req.ToPocketID, currency, req.Amount)
+	if err != nil {
+		if errors.Is(err, apperr.ErrInsufficientFunds) {
+			metrics.InsufficientFunds("transfer", currency)
+		}
+		c.Error(err)
+		return
+	}
+	metrics.Operation("transfer", currency, req.Amount)
+
+	c.JSON(http.StatusOK, TransferResponse{Transactions: txs})
+}
+
+// queryPocketID parse optional pocket_id query parameter, 0 is the default pocket
+func queryPocketID(c *gin.Context) (int64, error) {
+	raw := c.Query("pocket_id")
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apperr.Invalid("pocket_id must be a positive integer")
+	}
+	return id, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/storages"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RatesService struct {
+	rates  storages.Storage
+	maxAge time.Duration
+}
+
+type RatesResponse struct {
+	Rates []storages.Rate `json:"rates"`
+}
+
+// NewRatesService create new public rates service, maxAge is sent in Cache-Control
+func NewRatesService(rates storages.Storage, maxAge time.Duration) *RatesService {
+	return &RatesService{
+		rates:  rates,
+		maxAge: maxAge,
+	}
+}
+
+// GetRatesHandler godoc
+// @Summary      Get all exchange rates
+// @Description  Current rates for every pair of enabled currencies, served from the rate cache
+// @Tags         Rates
+// @Produce      json
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Success      200  {object}  RatesResponse
+// @Success      304  "Not modified"
+// @Failure      503  {object}  ErrorResponse "Rates unavailable"
+// @Router       /api/v1/rates [get]
+func (s *RatesService) GetRatesHandler(c *gin.Context) {
+	rates, err := s.rates.GetAllExchangeRates(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	s.writeCached(c, RatesResponse{Rates: rates})
+}
+
+// GetRateHandler godoc
+// @Summary      Get exchange rate for a pair
+// @Description  Current rate for one currency pair, served from the rate cache
+// @Tags         Rates
+// @Produce      json
+// @Param        from path string true "From currency"
+// @Param        to path string true "To currency"
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Success      200  {object}  storages.Rate
+// @Success      304  "Not modified"
+// @Failure      400  {object}  ErrorResponse "Unknown currency"
+// @Failure      503  {object}  ErrorResponse "Rate unavailable"
+// @Router       /api/v1/rates/{from}/{to} [get]
+func (s *RatesService) GetRateHandler(c *gin.Context) {
+	from := strings.ToUpper(c.Param("from"))
+	to := strings.ToUpper(c.Param("to"))
+
+	if from == to {
+		c.Error(apperr.Invalid("currencies must differ"))
+		return
+	}
+
+	rate, err := s.rates.GetExchangeRates(c.Request.Context(), from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	s.writeCached(c, rate)
+}
+
+// writeCached writes body with ETag and Cache-Control, answering 304 when the client copy is current
+func (s *RatesService) writeCached(c *gin.Context, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.maxAge.Seconds())))
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
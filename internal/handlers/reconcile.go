@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileService struct {
+	db *postgres.StorageConn
+}
+
+type ReconciliationRunsResponse struct {
+	Runs []postgres.ReconciliationRun `json:"runs"`
+}
+
+// NewReconcileService create reconciliation report service
+func NewReconcileService(db *postgres.StorageConn) *ReconcileService {
+	return &ReconcileService{db: db}
+}
+
+// RunReconciliationHandler godoc
+// @Summary      Run reconciliation
+// @Description  Check every wallet against its ledger and every currency's wallets against credits minus debits, then store the report
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      201  {object}  postgres.ReconciliationRun
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      409  {object}  ErrorResponse "Reconciliation is already running"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/reconciliation/runs [post]
+func (s *ReconcileService) RunReconciliationHandler(c *gin.Context) {
+	run, err := s.db.RunReconciliation(c.Request.Context(), postgres.ReconcileAdmin)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, run)
+}
+
+// ListRunsHandler godoc
+// @Summary      List reconciliation runs
+// @Description  Latest runs without totals and discrepancies
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        limit query int false "Maximum number of runs" default(20)
+// @Success      200  {object}  ReconciliationRunsResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/reconciliation/runs [get]
+func (s *ReconcileService) ListRunsHandler(c *gin.Context) {
+	limit, err := queryLimit(c, 20, 500)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	runs, err := s.db.ReconciliationRuns(c.Request.Context(), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, ReconciliationRunsResponse{Runs: runs})
+}
+
+// GetRunHandler godoc
+// @Summary      Get reconciliation run
+// @Description  Run with per currency totals and discrepancies, id "latest" returns the last run
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path string true "Run ID or latest"
+// @Success      200  {object}  postgres.ReconciliationRun
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "Reconciliation run not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/reconciliation/runs/{id} [get]
+func (s *ReconcileService) GetRunHandler(c *gin.Context) {
+	var id int64
+	if c.Param("id") != "latest" {
+		var err error
+		if id, err = pathID(c, "id"); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	run, err := s.db.ReconciliationRun(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MonthEndReport struct {
+	Month string `json:"month" example:"2026-03"`
+	// Last moment of the month, balances include every movement up to it
+	AsOf     time.Time                `json:"as_of"`
+	Balances []postgres.WalletBalance `json:"balances"`
+	// Sum of all wallet balances per currency
+	Totals map[string]float64 `json:"totals"`
+}
+
+// MonthEndReportHandler godoc
+// @Summary      Month-end balance report
+// @Description  Every non-zero wallet balance at the end of the month, served from the daily balance snapshots. CSV is streamed, JSON adds per currency totals.
+// @Tags         Admin
+// @Produce      text/csv
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        month query string false "Month as YYYY-MM, default the previous month"
+// @Param        format query string false "Report format" Enums(csv, json) default(csv)
+// @Success      200  {object}  MonthEndReport
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/reports/month-end [get]
+func (s *WalletService) MonthEndReportHandler(c *gin.Context) {
+	month, end, err := monthEnd(c.Query("month"), time.Now())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	ctx := c.Request.Context()
+
+	switch c.DefaultQuery("format", "csv") {
+	case "json":
+		report := MonthEndReport{Month: month, AsOf: end.Add(-time.Microsecond), Balances: []postgres.WalletBalance{}, Totals: map[string]float64{}}
+		err := s.db.BalancesBefore(ctx, end, func(b postgres.WalletBalance) error {
+			report.Balances = append(report.Balances, b)
+			report.Totals[b.Currency] += b.Amount
+			return nil
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		for currency, total := range report.Totals {
+			report.Totals[currency] = math.Round(total*100) / 100
+		}
+		c.JSON(http.StatusOK, report)
+
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="balances-%s.csv"`, month))
+		// The csv writer buffers, nothing reaches the client before the first few kilobytes
+		w := csv.NewWriter(c.Writer)
+		err := w.Write([]string{"user_id", "username", "pocket_id", "pocket", "currency", "balance"})
+		if err == nil {
+			err = s.db.BalancesBefore(ctx, end, func(b postgres.WalletBalance) error {
+				return w.Write([]string{strconv.Itoa(b.UserID), b.Username, strconv.FormatInt(b.PocketID, 10), b.Pocket,
+					b.Currency, strconv.FormatFloat(b.Amount, 'f', 2, 64)})
+			})
+		}
+		if err == nil {
+			w.Flush()
+			err = w.Error()
+		}
+		if err != nil {
+			if c.Writer.Written() {
+				slog.ErrorContext(ctx, "month-end report stream failed", "error", err)
+			} else {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+			}
+			c.Error(err)
+		}
+
+	default:
+		c.Error(apperr.Invalid("unknown format %q, want csv or json", c.Query("format")))
+	}
+}
+
+// monthEnd parse YYYY-MM, empty is the month before now, and return the month with the first
+// instant of the next one. Only months which already ended can be reported.
+func monthEnd(raw string, now time.Time) (string, time.Time, error) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	if raw != "" {
+		t, err := time.Parse("2006-01", raw)
+		if err != nil {
+			return "", time.Time{}, apperr.Invalid("month must look like 2026-03")
+		}
+		start = t
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(now) {
+		return "", time.Time{}, apperr.Invalid("month %s has not ended yet", start.Format("2006-01"))
+	}
+	return start.Format("2006-01"), end, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReverseRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	// Rate of an exchange reversal: original or current, default original
+	Rate string `json:"rate" binding:"omitempty,oneof=original current"`
+	// Post even if a wallet goes negative
+	Force bool `json:"force"`
+}
+
+type TransactionResponse struct {
+	// The entry and the other leg of its exchange or transfer, debit first
+	Transactions []postgres.Transaction `json:"transactions"`
+}
+
+// GetTransactionHandler godoc
+// @Summary      Get transaction
+// @Description  Ledger entry with the other leg of its exchange or transfer. reversed_by is set once it was reversed.
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Transaction ID"
+// @Success      200  {object}  TransactionResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "Transaction not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/transactions/{id} [get]
+func (s *WalletService) GetTransactionHandler(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	legs, err := s.db.TransactionLegs(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, TransactionResponse{Transactions: legs})
+}
+
+// ReverseTransactionHandler godoc
+// @Summary      Reverse transaction
+// @Description  Post compensating entries linked to the entry and the other leg of its exchange or transfer.
+// @Description  An exchange is reversed at its original rate, or at the current one where the whole credited amount is returned and converted back now.
+// @Description  A reversal debiting more than is available is refused unless forced, a forced one may leave a wallet negative.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Transaction ID"
+//
+//	@Param       input body ReverseRequest true "Reversal"
+//
+// @Success      201  {object}  postgres.Reversal
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "Transaction not found"
+// @Failure      409  {object}  ErrorResponse "Transaction is already reversed"
+// @Failure      422  {object}  ErrorResponse "Insufficient funds or not reversible"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Failure      503  {object}  ErrorResponse "Rate unavailable"
+// @Router       /api/v1/admin/transactions/{id}/reverse [post]
+func (s *WalletService) ReverseTransactionHandler(c *gin.Context) {
+	var req ReverseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	opts := postgres.ReversalRequest{Reason: req.Reason, Force: req.Force}
+	if req.Rate == "current" {
+		legs, err := s.db.TransactionLegs(ctx, id)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if legs[0].Kind != postgres.TxExchange || len(legs) != 2 {
+			c.Error(apperr.Invalid("rate applies to exchange reversals only"))
+			return
+		}
+		rate, err := s.exchanger.GetExchangeRate(ctx, legs[0].Currency, legs[1].Currency)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		opts.Rate = &rate
+	}
+
+	reversal, err := s.db.ReverseTransaction(ctx, id, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	for _, entry := range reversal.Entries {
+		metrics.Operation("reversal", entry.Currency, math.Abs(entry.Amount))
+	}
+	c.JSON(http.StatusCreated, reversal)
+}
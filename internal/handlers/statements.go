@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/statement"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatementHandler godoc
+// @Summary      Download statement
+// @Description  Opening balance, every movement and closing balance of one currency for a period. The file is streamed as CSV, OFX 2.2 or camt.053.001.02.
+// @Description  from and to accept a date (YYYY-MM-DD, to is inclusive) or RFC 3339 time. Default period is the current month up to now.
+// @Tags         Wallet
+// @Produce      text/csv
+// @Produce      application/x-ofx
+// @Produce      application/xml
+// @Param        Authorization header string true "Bearer token"
+// @Param        currency query string true "Currency"
+// @Param        from query string false "Start of the period"
+// @Param        to query string false "End of the period"
+// @Param        format query string false "File format" Enums(csv, ofx, camt053) default(csv)
+// @Param        pocket_id query int false "Pocket ID"
+// @Success      200  {file}    file
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Pocket not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/wallet/statements [get]
+func (s *WalletService) StatementHandler(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	currency, err := s.currency(c.Query("currency"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	pocketID, err := queryPocketID(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	from, err := periodBound(c.Query("from"), false, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	to, err := periodBound(c.Query("to"), true, now)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !from.Before(to) {
+		c.Error(apperr.Invalid("from must be before to"))
+		return
+	}
+
+	format := c.DefaultQuery("format", statement.CSV)
+	w, err := statement.New(format, c.Writer)
+	if err != nil {
+		c.Error(apperr.Invalid("%v", err))
+		return
+	}
+
+	begin := func(sum postgres.StatementSummary) error {
+		// Headers go out only now, errors found before still get the JSON envelope
+		contentType, ext := statement.ContentType(format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s-%s-%s.%s"`,
+			currency, from.Format("20060102"), to.Add(-time.Nanosecond).Format("20060102"), ext))
+		c.Status(http.StatusOK)
+
+		return w.Begin(statement.Info{
+			ID:          fmt.Sprintf("STMT-%d-%d-%s-%s", userID, sum.PocketID, currency, from.Format("20060102")),
+			Account:     fmt.Sprintf("%d-%d-%s", userID, sum.PocketID, currency),
+			Currency:    currency,
+			From:        from,
+			To:          to,
+			CreatedAt:   now,
+			Opening:     sum.Opening,
+			Closing:     sum.Closing,
+			Credits:     sum.Credits,
+			Debits:      sum.Debits,
+			CreditCount: sum.CreditCount,
+			DebitCount:  sum.DebitCount,
+		})
+	}
+	entry := func(t postgres.Transaction) error {
+		return w.Entry(statement.Entry{ID: t.ID, Time: t.CreatedAt, Kind: t.Kind, Description: entryDescription(t), Amount: t.Amount})
+	}
+
+	// A long period streams for longer than the server write timeout allows,
+	// the request context still ends the stream when the client goes away
+	ctx := c.Request.Context()
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(ctx, "failed to clear statement write deadline", "error", err)
+	}
+	err = s.db.Statement(ctx, userID, pocketID, currency, from, to, begin, entry)
+	if err == nil {
+		err = w.End()
+	}
+	if err != nil {
+		if c.Writer.Written() {
+			// The status is already sent, the file stays without its closing balance
+			slog.ErrorContext(ctx, "statement stream failed", "error", err)
+		} else {
+			c.Writer.Header().Del("Content-Disposition")
+		}
+		c.Error(err)
+	}
+}
+
+// periodBound parse date or RFC 3339 time, a date as end of the period includes the whole day
+func periodBound(raw string, end bool, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return time.Time{}, apperr.Invalid("invalid date %q, want YYYY-MM-DD or RFC 3339", raw)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// entryDescription explain a ledger entry for statement readers
+func entryDescription(t postgres.Transaction) string {
+	switch {
+	case t.Reason != "":
+		return t.Reason
+	case t.Rate != nil:
+		return "exchange at rate " + strconv.FormatFloat(*t.Rate, 'f', -1, 64)
+	case t.HoldID != nil:
+		return fmt.Sprintf("capture of hold %d", *t.HoldID)
+	case t.Kind == postgres.TxTransfer && t.Amount < 0:
+		return "transfer to another pocket"
+	case t.Kind == postgres.TxTransfer:
+		return "transfer from another pocket"
+	}
+	return ""
+}
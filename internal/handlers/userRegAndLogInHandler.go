@@ -1,9 +1,11 @@
 package handlers
 
 import (
-	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 
+	"gw-currncy-wallet/internal/apperr"
 	"gw-currncy-wallet/internal/auth"
 	postgres "gw-currncy-wallet/internal/storages/postgres"
 	"gw-currncy-wallet/pkg/pswcrypt"
@@ -13,6 +15,8 @@ import (
 
 type UserStruct struct {
 	db *postgres.StorageConn
+	// Secret signing the issued tokens
+	jwtSecret []byte
 }
 
 type LoginRequset struct {
@@ -26,8 +30,8 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
-func NewUserService(db *postgres.StorageConn) *UserStruct {
-	return &UserStruct{db: db}
+func NewUserService(db *postgres.StorageConn, jwtSecret []byte) *UserStruct {
+	return &UserStruct{db: db, jwtSecret: jwtSecret}
 }
 
 // RegisterHandler godoc
@@ -40,9 +44,9 @@ func NewUserService(db *postgres.StorageConn) *UserStruct {
 //	@Param        input body RegisterRequest true "User registration data"
 //
 // @Success      201  {object}  map[string]string "User registered successfully"
-// @Failure      400  {object}  map[string]string "Invalid input"
-// @Failure      409  {object}  map[string]string "Username or email already exists"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      409  {object}  ErrorResponse "Username or email already exists"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
 // @Router       /api/v1/register [post]
 func (u *UserStruct) RegisterHandler(c *gin.Context) {
 	var req struct {
@@ -53,19 +57,19 @@ func (u *UserStruct) RegisterHandler(c *gin.Context) {
 	// Check input data
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 	hashedPasswrd, err := pswcrypt.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		c.Error(err)
 		return
 	}
 
-	ctx := context.Background()
+	ctx := c.Request.Context()
 	userID, err := u.db.CreateUser(ctx, req.Username, req.Email, string(hashedPasswrd))
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully", "user_id": userID})
@@ -81,9 +85,9 @@ func (u *UserStruct) RegisterHandler(c *gin.Context) {
 //	@Param        input body LoginRequset true "Login data"
 //
 // @Success      200  {object}  map[string]string "JWT token"
-// @Failure      400  {object}  map[string]string "Invalid input"
-// @Failure      401  {object}  map[string]string "Invalid username or password"
-// @Failure      500  {object}  map[string]string "Internal Server Error"
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Invalid username or password"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
 // @Router       /api/v1/login [post]
 func (u *UserStruct) LoginHandler(c *gin.Context) {
 	var req struct {
@@ -93,32 +97,65 @@ func (u *UserStruct) LoginHandler(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	user, err := u.db.GetUserData(ctx, req.Username)
+	if errors.Is(err, apperr.ErrUserNotFound) {
+		u.loginFailed(c, nil, req.Username, "unknown user")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		c.Error(err)
 		return
 	}
 
 	err = pswcrypt.CheckPaswword(user.Password, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		u.loginFailed(c, &user.ID, req.Username, "wrong password")
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	err = u.db.Audit(ctx, postgres.AuditRecord{Action: postgres.AuditLoginSuccess, ActorID: &user.ID, UserID: &user.ID})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	token, err := auth.GenerateToken(u.jwtSecret, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// No token leaves the service without a trace
+	err = u.db.Audit(ctx, postgres.AuditRecord{Action: postgres.AuditTokenIssued, ActorID: &user.ID, UserID: &user.ID})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
+// loginFailed audit the failed attempt and answer with the same error whatever the reason was
+func (u *UserStruct) loginFailed(c *gin.Context, userID *int, username, reason string) {
+	// Anyone can send a failed login, keep the log from growing by whatever they post
+	if len(username) > 128 {
+		username = username[:128]
+	}
+	err := u.db.Audit(c.Request.Context(), postgres.AuditRecord{
+		Action:  postgres.AuditLoginFailure,
+		UserID:  userID,
+		Details: map[string]any{"username": username, "reason": reason},
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to audit login failure", "error", err)
+	}
+	c.Error(apperr.ErrBadCredentials)
+}
+
 // Test
 func (u *UserStruct) GetUserDataHandler(c *gin.Context) {
 	var req struct {
@@ -127,15 +164,15 @@ func (u *UserStruct) GetUserDataHandler(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		c.Error(invalidBody(err))
 		return
 	}
 
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	user, err := u.db.GetUserData(ctx, req.Username)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(err)
 		return
 	}
 
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/storages"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxHistoryDays bounds the points of one net worth history
+const maxHistoryDays = 366
+
+// Valuation is a set of balances converted into one currency
+type Valuation struct {
+	Currency string `json:"currency" example:"USD"`
+	// Every non-zero total converted, keyed by source currency
+	Values map[string]float64 `json:"values"`
+	// Sum of the values
+	Total float64 `json:"total"`
+	// Rates used, keyed by source currency, with the moment each was fetched
+	Rates map[string]storages.Rate `json:"rates"`
+	// Currencies left out of the total because no rate was recorded before that moment
+	Unvalued []string `json:"unvalued,omitempty"`
+}
+
+type NetWorthPoint struct {
+	Date string `json:"date" example:"2026-03-31"`
+	// End of the day, or now for the current day
+	AsOf time.Time `json:"as_of"`
+	// Totals over all pockets per currency
+	Balances  map[string]float64 `json:"balances"`
+	Valuation Valuation          `json:"valuation"`
+}
+
+type NetWorthResponse struct {
+	Currency string          `json:"currency" example:"USD"`
+	Points   []NetWorthPoint `json:"points"`
+}
+
+// NetWorthHandler godoc
+// @Summary      Net worth history
+// @Description  Daily totals over all pockets valued in one currency with the rates recorded at each day end, for net worth charts.
+// @Description  Days default to the last 30, at most 366 per request.
+// @Tags         Wallet
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        valuation query string true "Valuation currency"
+// @Param        from query string false "First day, YYYY-MM-DD"
+// @Param        to query string false "Last day, YYYY-MM-DD, default today"
+// @Success      200  {object}  NetWorthResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/balance/history [get]
+func (s *WalletService) NetWorthHandler(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		return
+	}
+	s.netWorth(c, userID)
+}
+
+// AdminNetWorthHandler godoc
+// @Summary      User net worth history
+// @Description  Daily totals of any user over all pockets valued in one currency
+// @Tags         Admin
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "User ID"
+// @Param        valuation query string true "Valuation currency"
+// @Param        from query string false "First day, YYYY-MM-DD"
+// @Param        to query string false "Last day, YYYY-MM-DD, default today"
+// @Success      200  {object}  NetWorthResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Forbidden"
+// @Failure      404  {object}  ErrorResponse "User not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/admin/users/{id}/balance/history [get]
+func (s *WalletService) AdminNetWorthHandler(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	s.netWorth(c, int(id))
+}
+
+// netWorth answer with one valued point per day between ?from and ?to
+func (s *WalletService) netWorth(c *gin.Context, userID int) {
+	if c.Query("valuation") == "" {
+		c.Error(apperr.Invalid("valuation currency is required"))
+		return
+	}
+	currency, err := s.currency(c.Query("valuation"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	last, err := historyDay(c.Query("to"), today)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	first, err := historyDay(c.Query("from"), last.AddDate(0, 0, -29))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	switch {
+	case last.After(today):
+		c.Error(apperr.Invalid("to must not be in the future"))
+		return
+	case first.After(last):
+		c.Error(apperr.Invalid("from must not be after to"))
+		return
+	case last.Sub(first) >= maxHistoryDays*24*time.Hour:
+		c.Error(apperr.Invalid("at most %d days per request", maxHistoryDays))
+		return
+	}
+
+	// A day is valued at its last microsecond, today at the current moment
+	var moments []time.Time
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		moments = append(moments, minTime(day.AddDate(0, 0, 1).Add(-time.Microsecond), now))
+	}
+
+	history, err := s.db.NetWorthHistory(c.Request.Context(), userID, currency, moments)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp := NetWorthResponse{Currency: currency, Points: make([]NetWorthPoint, 0, len(history))}
+	for _, p := range history {
+		resp.Points = append(resp.Points, NetWorthPoint{
+			Date:      p.At.Format(time.DateOnly),
+			AsOf:      p.At,
+			Balances:  p.Balances,
+			Valuation: valuate(currency, p.Balances, p.Rates),
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// valuation convert the totals into the currency in ?valuation, nil when it is not asked.
+// Current balances use live rates, historical ones the rates recorded before asOf.
+func (s *WalletService) valuation(ctx context.Context, code string, balances map[string]postgres.Balance, asOf *time.Time) (*Valuation, error) {
+	if code == "" {
+		return nil, nil
+	}
+	currency, err := s.currency(code)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(balances))
+	for c, b := range balances {
+		totals[c] = b.Total
+	}
+
+	var rates map[string]storages.Rate
+	if asOf != nil {
+		if rates, err = s.db.RatesAt(ctx, currency, *asOf); err != nil {
+			return nil, err
+		}
+	} else {
+		rates = make(map[string]storages.Rate)
+		for c, total := range totals {
+			if total == 0 || c == currency {
+				continue
+			}
+			rate, err := s.exchanger.GetExchangeRates(ctx, c, currency)
+			if err != nil {
+				return nil, err
+			}
+			rates[c] = rate
+		}
+	}
+
+	v := valuate(currency, totals, rates)
+	return &v, nil
+}
+
+// valuate convert every non-zero total with its rate, totals without a rate are listed as unvalued
+func valuate(currency string, totals map[string]float64, rates map[string]storages.Rate) Valuation {
+	v := Valuation{Currency: currency, Values: map[string]float64{}, Rates: map[string]storages.Rate{}}
+	for c, total := range totals {
+		if total == 0 {
+			continue
+		}
+		if c == currency {
+			v.Values[c] = total
+			v.Total += total
+			continue
+		}
+		rate, ok := rates[c]
+		if !ok {
+			v.Unvalued = append(v.Unvalued, c)
+			continue
+		}
+		value := math.Round(total*rate.Rate*100) / 100
+		v.Values[c] = value
+		v.Rates[c] = rate
+		v.Total += value
+	}
+	v.Total = math.Round(v.Total*100) / 100
+	slices.Sort(v.Unvalued)
+	return v
+}
+
+// historyDay parse a YYYY-MM-DD day of the net worth history
+func historyDay(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return time.Time{}, apperr.Invalid("invalid day %q, want YYYY-MM-DD", raw)
+	}
+	return day, nil
+}
+
+// minTime return the earlier of two moments
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+
+	"gw-currncy-wallet/internal/apperr"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+	"gw-currncy-wallet/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookService manages webhook endpoints. The user API only sees endpoints of the caller,
+// the admin API sees all of them and may register endpoints for every user.
+type WebhookService struct {
+	db      *postgres.StorageConn
+	admin   bool
+	targets webhooks.TargetPolicy
+}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	// Admin API only: events of this user, empty subscribes to every user
+	UserID int `json:"user_id" binding:"omitempty,gt=0"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []postgres.WebhookEndpoint `json:"webhooks"`
+}
+
+type DeliveriesResponse struct {
+	Deliveries []postgres.WebhookDelivery `json:"deliveries"`
+}
+
+// NewWebhookService create webhook service, admin services are not limited to the caller's endpoints.
+// Endpoint URLs must pass the target policy.
+func NewWebhookService(db *postgres.StorageConn, admin bool, targets webhooks.TargetPolicy) *WebhookService {
+	return &WebhookService{
+		db:      db,
+		admin:   admin,
+		targets: targets,
+	}
+}
+
+// owner return whose endpoints the request may touch, 0 means all
+func (s *WebhookService) owner(c *gin.Context) (int, bool) {
+	if s.admin {
+		return 0, true
+	}
+	return userID(c)
+}
+
+// CreateWebhookHandler godoc
+// @Summary      Register webhook
+// @Description  Register an endpoint for event types. The signing secret is returned only once.
+// @Description  Every delivery is a POST with X-Webhook-Id, X-Webhook-Event, X-Webhook-Timestamp and X-Webhook-Signature: v1=hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+//
+//	@Param       input body CreateWebhookRequest true "Endpoint and event types: deposit.completed, withdrawal.completed, exchange.completed, transaction.reversed, hold.placed, hold.captured, hold.released, hold.expired"
+//
+// @Success      201  {object}  postgres.WebhookEndpoint
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Admin access required"
+// @Failure      404  {object}  ErrorResponse "User not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/webhooks [post]
+// @Router       /api/v1/admin/webhooks [post]
+func (s *WebhookService) CreateWebhookHandler(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+	if err := s.targets.CheckURL(c.Request.Context(), req.URL); err != nil {
+		c.Error(apperr.Invalid("%v", err))
+		return
+	}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(postgres.EventTypes, t) {
+			c.Error(apperr.Invalid("unknown event type %q", t))
+			return
+		}
+	}
+	slices.Sort(req.EventTypes)
+	eventTypes := slices.Compact(req.EventTypes)
+
+	var owner *int
+	if s.admin {
+		if req.UserID != 0 {
+			owner = &req.UserID
+		}
+	} else {
+		id, ok := userID(c)
+		if !ok {
+			return
+		}
+		owner = &id
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		c.Error(err)
+		return
+	}
+
+	webhook, err := s.db.CreateWebhook(c.Request.Context(), owner, req.URL, "whsec_"+hex.EncodeToString(buf), eventTypes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// ListWebhooksHandler godoc
+// @Summary      List webhooks
+// @Description  Registered endpoints without their secrets
+// @Tags         Webhooks
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200  {object}  WebhooksResponse
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      403  {object}  ErrorResponse "Admin access required"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/webhooks [get]
+// @Router       /api/v1/admin/webhooks [get]
+func (s *WebhookService) ListWebhooksHandler(c *gin.Context) {
+	owner, ok := s.owner(c)
+	if !ok {
+		return
+	}
+
+	webhooks, err := s.db.Webhooks(c.Request.Context(), owner)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, WebhooksResponse{Webhooks: webhooks})
+}
+
+// DeleteWebhookHandler godoc
+// @Summary      Delete webhook
+// @Description  Remove the endpoint, pending deliveries are dropped
+// @Tags         Webhooks
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Webhook ID"
+// @Success      204
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Webhook not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/webhooks/{id} [delete]
+// @Router       /api/v1/admin/webhooks/{id} [delete]
+func (s *WebhookService) DeleteWebhookHandler(c *gin.Context) {
+	owner, ok := s.owner(c)
+	if !ok {
+		return
+	}
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := s.db.DeleteWebhook(c.Request.Context(), owner, id); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveriesHandler godoc
+// @Summary      List webhook deliveries
+// @Description  Latest deliveries of the endpoint, status=dead lists the dead letters
+// @Tags         Webhooks
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Webhook ID"
+// @Param        status query string false "Filter by status" Enums(pending, delivered, dead)
+// @Param        limit query int false "Maximum number of deliveries" default(50)
+// @Success      200  {object}  DeliveriesResponse
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Webhook not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/webhooks/{id}/deliveries [get]
+// @Router       /api/v1/admin/webhooks/{id}/deliveries [get]
+func (s *WebhookService) ListDeliveriesHandler(c *gin.Context) {
+	owner, ok := s.owner(c)
+	if !ok {
+		return
+	}
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", postgres.DeliveryPending, postgres.DeliveryDelivered, postgres.DeliveryDead:
+	default:
+		c.Error(apperr.Invalid("unknown delivery status %q", status))
+		return
+	}
+	limit, err := queryLimit(c, 50, 500)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	deliveries, err := s.db.WebhookDeliveries(c.Request.Context(), owner, id, status, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, DeliveriesResponse{Deliveries: deliveries})
+}
+
+// ReplayDeliveryHandler godoc
+// @Summary      Replay webhook delivery
+// @Description  Send the delivery again with a fresh retry budget, typically a dead letter after the endpoint is fixed
+// @Tags         Webhooks
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Param        id path int true "Webhook ID"
+// @Param        delivery_id path int true "Delivery ID"
+// @Success      200  {object}  postgres.WebhookDelivery
+// @Failure      400  {object}  ErrorResponse "Invalid input"
+// @Failure      401  {object}  ErrorResponse "Unauthorized"
+// @Failure      404  {object}  ErrorResponse "Delivery not found"
+// @Failure      500  {object}  ErrorResponse "Internal Server Error"
+// @Router       /api/v1/webhooks/{id}/deliveries/{delivery_id}/replay [post]
+// @Router       /api/v1/admin/webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (s *WebhookService) ReplayDeliveryHandler(c *gin.Context) {
+	owner, ok := s.owner(c)
+	if !ok {
+		return
+	}
+	id, err := pathID(c, "id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	deliveryID, err := pathID(c, "delivery_id")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	delivery, err := s.db.ReplayDelivery(c.Request.Context(), owner, id, deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
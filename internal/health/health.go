@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckFunc return nil when the dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// CheckResult is the outcome of one dependency check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body of the readiness probe
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs dependency checks for the probes
+type Checker struct {
+	mu      sync.RWMutex
+	checks  []check
+	timeout time.Duration
+}
+
+// NewChecker create checker, every check gets at most timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add register named readiness check
+func (h *Checker) Add(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check{name: name, fn: fn})
+}
+
+// Run execute all checks concurrently
+func (h *Checker) Run(ctx context.Context) ReadinessResponse {
+	h.mu.RLock()
+	checks := append([]check(nil), h.checks...)
+	h.mu.RUnlock()
+
+	resp := ReadinessResponse{Status: "ready", Checks: make(map[string]CheckResult, len(checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.fn(ctx)
+			result := CheckResult{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			resp.Checks[c.name] = result
+			if err != nil {
+				resp.Status = "not_ready"
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return resp
+}
+
+// LivenessHandler godoc
+// @Summary      Liveness probe
+// @Description  Reports that the process is up, without touching dependencies
+// @Tags         Health
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Router       /healthz [get]
+func (h *Checker) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadinessHandler godoc
+// @Summary      Readiness probe
+// @Description  Checks every dependency and reports per check status and latency
+// @Tags         Health
+// @Produce      json
+// @Success      200  {object}  health.ReadinessResponse
+// @Failure      503  {object}  health.ReadinessResponse
+// @Router       /readyz [get]
+func (h *Checker) ReadinessHandler(c *gin.Context) {
+	resp := h.Run(c.Request.Context())
+	status := http.StatusOK
+	if resp.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "wallet"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	exchangerCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of single gRPC attempts to the exchanger.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2, 5},
+	}, []string{"method", "code"})
+
+	exchangerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "errors_total",
+		Help:      "Failed gRPC attempts to the exchanger by status code.",
+	}, []string{"method", "code"})
+
+	exchangerRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "retries_total",
+		Help:      "Retried gRPC calls to the exchanger.",
+	}, []string{"method"})
+
+	exchangerBreakerRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "breaker_rejected_total",
+		Help:      "Calls failed fast by the open circuit breaker.",
+	})
+
+	exchangerBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "breaker_state",
+		Help:      "Circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	})
+
+	rateCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rate_cache",
+		Name:      "lookups_total",
+		Help:      "Rate cache lookups by result.",
+	}, []string{"result"})
+
+	rateGuardRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rate_guard",
+		Name:      "rejected_total",
+		Help:      "Quotes rejected by the rate sanity guard.",
+	}, []string{"pair"})
+
+	exchangerUnpriced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exchanger",
+		Name:      "unpriced_pairs_total",
+		Help:      "Enabled pairs missing from bulk rates responses.",
+	})
+
+	walletOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Successful wallet operations by currency.",
+	}, []string{"operation", "currency"})
+
+	walletVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "volume_total",
+		Help:      "Amount moved by wallet operations, in units of the currency.",
+	}, []string{"operation", "currency"})
+
+	insufficientFunds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insufficient_funds_total",
+		Help:      "Operations refused because of insufficient funds.",
+	}, []string{"operation", "currency"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "Webhook delivery attempts by result: delivered, retry or dead.",
+	}, []string{"result"})
+
+	webhookDeliveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "delivery_duration_seconds",
+		Help:      "Latency of webhook HTTP requests.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	reconcileRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "runs_total",
+		Help:      "Reconciliation runs by status: ok, mismatch or failed.",
+	}, []string{"status"})
+
+	// Alert on this being above zero
+	reconcileDiscrepancies = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "discrepancies",
+		Help:      "Discrepancies found by the last completed reconciliation run.",
+	})
+
+	reconcileLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Time of the last completed reconciliation run.",
+	})
+)
+
+// Handler serve metrics of the default registry
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB export sql.DBStats pool gauges
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware record latency of every request by route template and status
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// ExchangerCall record one gRPC attempt
+func ExchangerCall(method string, d time.Duration, err error) {
+	code := status.Code(err).String()
+	exchangerCallDuration.WithLabelValues(method, code).Observe(d.Seconds())
+	if err != nil {
+		exchangerErrors.WithLabelValues(method, code).Inc()
+	}
+}
+
+// ExchangerRetry record a retried call
+func ExchangerRetry(method string) {
+	exchangerRetries.WithLabelValues(method).Inc()
+}
+
+// ExchangerBreakerRejected record a call refused by the open breaker
+func ExchangerBreakerRejected() {
+	exchangerBreakerRejected.Inc()
+}
+
+// ExchangerBreakerState record breaker state as a number
+func ExchangerBreakerState(state int) {
+	exchangerBreakerState.Set(float64(state))
+}
+
+// RateCacheLookup record a cache hit or miss
+func RateCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	rateCacheLookups.WithLabelValues(result).Inc()
+}
+
+// RateRejected record a quote rejected by the rate guard
+func RateRejected(pair string) {
+	rateGuardRejected.WithLabelValues(pair).Inc()
+}
+
+// RatesUnpriced record enabled pairs a bulk rates response could not price
+func RatesUnpriced(n int) {
+	exchangerUnpriced.Add(float64(n))
+}
+
+// Operation record a successful wallet operation and its amount
+func Operation(operation, currency string, amount float64) {
+	walletOperations.WithLabelValues(operation, currency).Inc()
+	walletVolume.WithLabelValues(operation, currency).Add(amount)
+}
+
+// InsufficientFunds record an operation refused for lack of funds
+func InsufficientFunds(operation, currency string) {
+	insufficientFunds.WithLabelValues(operation, currency).Inc()
+}
+
+// WebhookDelivery record one webhook attempt
+func WebhookDelivery(result string, d time.Duration) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+	webhookDeliveryDuration.Observe(d.Seconds())
+}
+
+// Reconciliation record a finished reconciliation run, failed runs keep the last result
+func Reconciliation(status string, discrepancies int) {
+	reconcileRuns.WithLabelValues(status).Inc()
+	if status == "failed" {
+		return
+	}
+	reconcileDiscrepancies.Set(float64(discrepancies))
+	reconcileLastRun.SetToCurrentTime()
+}
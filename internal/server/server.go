@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gw-currncy-wallet/internal/config"
+	"gw-currncy-wallet/internal/tlsutil"
+)
+
+// Server is the HTTP server with readiness flag and graceful shutdown
+type Server struct {
+	http            *http.Server
+	ready           atomic.Bool
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+}
+
+// New create HTTP server with timeouts from config, HTTPS when a certificate is configured
+func New(handler http.Handler, cfg config.HTTP) (*Server, error) {
+	s := &Server{
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		drainDelay:      cfg.DrainDelay,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+
+	if cfg.TLSCertFile != "" {
+		tlsCfg, err := tlsutil.ServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		s.http.TLSConfig = tlsCfg
+	}
+	return s, nil
+}
+
+// Ready reports whether the server accepts new traffic
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Run serve until ctx is done, then drain in-flight requests.
+// On shutdown the server first reports not ready and waits DrainDelay so load balancers
+// stop routing to it, then stops accepting connections and waits for running requests
+// up to ShutdownTimeout.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "addr", s.http.Addr, "tls", s.http.TLSConfig != nil)
+		s.ready.Store(true)
+
+		var err error
+		if s.http.TLSConfig != nil {
+			// Certificate comes from TLSConfig.GetCertificate
+			err = s.http.ListenAndServeTLS("", "")
+		} else {
+			err = s.http.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		s.ready.Store(false)
+		if err != nil {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests", "drain_delay", s.drainDelay)
+	s.ready.Store(false)
+	if s.drainDelay > 0 {
+		time.Sleep(s.drainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to drain requests: %w", err)
+	}
+	slog.Info("server stopped")
+	return nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Workers runs background jobs that stop together on shutdown
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkers create worker group, jobs get a context cancelled by Stop
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Go start a named background job
+func (w *Workers) Go(name string, job func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		job(w.ctx)
+		slog.Info("worker stopped", "worker", name)
+	}()
+}
+
+// Stop cancel all jobs and wait for them up to timeout
+func (w *Workers) Stop(timeout time.Duration) {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("workers did not stop in time", "timeout", timeout)
+	}
+}
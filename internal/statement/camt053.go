@@ -0,0 +1,186 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+const camtNamespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtGroupHeader struct {
+	XMLName   xml.Name `xml:"GrpHdr"`
+	MsgID     string   `xml:"MsgId"`
+	CreatedAt string   `xml:"CreDtTm"`
+}
+
+type camtPeriod struct {
+	XMLName xml.Name `xml:"FrToDt"`
+	From    string   `xml:"FrDtTm"`
+	To      string   `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	XMLName  xml.Name `xml:"Acct"`
+	ID       string   `xml:"Id>Othr>Id"`
+	Currency string   `xml:"Ccy"`
+}
+
+type camtBalance struct {
+	XMLName xml.Name   `xml:"Bal"`
+	Code    string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount  camtAmount `xml:"Amt"`
+	CdtDbt  string     `xml:"CdtDbtInd"`
+	Date    string     `xml:"Dt>Dt"`
+}
+
+type camtTotals struct {
+	Count  string `xml:"NbOfNtries"`
+	Sum    string `xml:"Sum"`
+	Net    string `xml:"TtlNetNtryAmt,omitempty"`
+	CdtDbt string `xml:"CdtDbtInd,omitempty"`
+}
+
+type camtSummary struct {
+	XMLName xml.Name   `xml:"TxsSummry"`
+	Total   camtTotals `xml:"TtlNtries"`
+	Credits camtTotals `xml:"TtlCdtNtries"`
+	Debits  camtTotals `xml:"TtlDbtNtries"`
+}
+
+type camtEntry struct {
+	XMLName     xml.Name   `xml:"Ntry"`
+	Ref         string     `xml:"NtryRef"`
+	Amount      camtAmount `xml:"Amt"`
+	CdtDbt      string     `xml:"CdtDbtInd"`
+	Status      string     `xml:"Sts"`
+	BookingDate string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>DtTm"`
+	ServicerRef string     `xml:"AcctSvcrRef"`
+	Code        string     `xml:"BkTxCd>Prtry>Cd"`
+	Issuer      string     `xml:"BkTxCd>Prtry>Issr"`
+	Info        string     `xml:"AddtlNtryInf,omitempty"`
+}
+
+// camtWriter write an ISO 20022 camt.053.001.02 bank to customer statement
+type camtWriter struct {
+	enc  *xml.Encoder
+	info Info
+}
+
+func newCamtWriter(w io.Writer) *camtWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &camtWriter{enc: enc}
+}
+
+// camtTime format ISODateTime in UTC
+func camtTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// creditDebit return CRDT for zero and positive amounts, DBIT for negative
+func creditDebit(v float64) string {
+	if v < 0 {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func (c *camtWriter) Begin(info Info) error {
+	c.info = info
+	if err := c.enc.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)}); err != nil {
+		return err
+	}
+	if err := c.enc.EncodeToken(xml.CharData("\n")); err != nil {
+		return err
+	}
+	document := xml.StartElement{
+		Name: xml.Name{Local: "Document"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: camtNamespace}},
+	}
+	if err := c.enc.EncodeToken(document); err != nil {
+		return err
+	}
+	if err := c.start("BkToCstmrStmt"); err != nil {
+		return err
+	}
+	created := camtTime(info.CreatedAt)
+	if err := c.enc.Encode(camtGroupHeader{MsgID: truncate(info.ID, 35), CreatedAt: created}); err != nil {
+		return err
+	}
+
+	if err := c.start("Stmt"); err != nil {
+		return err
+	}
+	if err := c.enc.EncodeElement(truncate(info.ID, 35), xml.StartElement{Name: xml.Name{Local: "Id"}}); err != nil {
+		return err
+	}
+	if err := c.enc.EncodeElement(created, xml.StartElement{Name: xml.Name{Local: "CreDtTm"}}); err != nil {
+		return err
+	}
+	if err := c.enc.Encode(camtPeriod{From: camtTime(info.From), To: camtTime(info.To)}); err != nil {
+		return err
+	}
+	if err := c.enc.Encode(camtAccount{ID: truncate(info.Account, 34), Currency: info.Currency}); err != nil {
+		return err
+	}
+
+	// OPBD is dated the first day of the period, CLBD the last one, To itself is excluded
+	balances := []camtBalance{
+		{Code: "OPBD", Amount: camtAmount{info.Currency, absAmount(info.Opening)}, CdtDbt: creditDebit(info.Opening), Date: info.From.UTC().Format(time.DateOnly)},
+		{Code: "CLBD", Amount: camtAmount{info.Currency, absAmount(info.Closing)}, CdtDbt: creditDebit(info.Closing), Date: info.To.Add(-time.Nanosecond).UTC().Format(time.DateOnly)},
+	}
+	for _, b := range balances {
+		if err := c.enc.Encode(b); err != nil {
+			return err
+		}
+	}
+
+	net := info.Credits - info.Debits
+	return c.enc.Encode(camtSummary{
+		Total: camtTotals{
+			Count:  strconv.Itoa(info.CreditCount + info.DebitCount),
+			Sum:    amount(info.Credits + info.Debits),
+			Net:    absAmount(net),
+			CdtDbt: creditDebit(net),
+		},
+		Credits: camtTotals{Count: strconv.Itoa(info.CreditCount), Sum: amount(info.Credits)},
+		Debits:  camtTotals{Count: strconv.Itoa(info.DebitCount), Sum: amount(info.Debits)},
+	})
+}
+
+func (c *camtWriter) Entry(e Entry) error {
+	ref := strconv.FormatInt(e.ID, 10)
+	return c.enc.Encode(camtEntry{
+		Ref:         ref,
+		Amount:      camtAmount{c.info.Currency, absAmount(e.Amount)},
+		CdtDbt:      creditDebit(e.Amount),
+		Status:      "BOOK",
+		BookingDate: camtTime(e.Time),
+		ValueDate:   camtTime(e.Time),
+		ServicerRef: ref,
+		Code:        truncate(e.Kind, 35),
+		Issuer:      ofxBankID,
+		Info:        truncate(e.Description, 500),
+	})
+}
+
+func (c *camtWriter) End() error {
+	for _, name := range []string{"Stmt", "BkToCstmrStmt", "Document"} {
+		if err := c.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	return c.enc.Close()
+}
+
+func (c *camtWriter) start(name string) error {
+	return c.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}})
+}
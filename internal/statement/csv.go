@@ -0,0 +1,45 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvWriter write RFC 4180 CSV with the opening balance as first row and the closing balance as last row
+type csvWriter struct {
+	w       *csv.Writer
+	info    Info
+	balance float64
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Begin(info Info) error {
+	c.info = info
+	c.balance = info.Opening
+	if err := c.w.Write([]string{"date", "type", "reference", "description", "amount", "balance", "currency"}); err != nil {
+		return err
+	}
+	return c.w.Write([]string{info.From.UTC().Format(time.RFC3339), "opening_balance", "", "", "", amount(info.Opening), info.Currency})
+}
+
+func (c *csvWriter) Entry(e Entry) error {
+	c.balance += e.Amount
+	return c.w.Write([]string{
+		e.Time.UTC().Format(time.RFC3339), e.Kind, strconv.FormatInt(e.ID, 10), e.Description,
+		amount(e.Amount), amount(c.balance), c.info.Currency,
+	})
+}
+
+func (c *csvWriter) End() error {
+	// The closing row uses the ledger total, not the running sum of rounded floats
+	if err := c.w.Write([]string{c.info.To.UTC().Format(time.RFC3339), "closing_balance", "", "", "", amount(c.info.Closing), c.info.Currency}); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,207 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Bank and account ids are limited to 9 and 22 characters by OFX
+const ofxBankID = "GWWALLET"
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignon struct {
+	XMLName  xml.Name  `xml:"SONRS"`
+	Status   ofxStatus `xml:"STATUS"`
+	DTServer string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+}
+
+type ofxAccount struct {
+	XMLName  xml.Name `xml:"BANKACCTFROM"`
+	BankID   string   `xml:"BANKID"`
+	AcctID   string   `xml:"ACCTID"`
+	AcctType string   `xml:"ACCTTYPE"`
+}
+
+type ofxTransaction struct {
+	XMLName  xml.Name `xml:"STMTTRN"`
+	TrnType  string   `xml:"TRNTYPE"`
+	DTPosted string   `xml:"DTPOSTED"`
+	TrnAmt   string   `xml:"TRNAMT"`
+	FITID    string   `xml:"FITID"`
+	Name     string   `xml:"NAME,omitempty"`
+	Memo     string   `xml:"MEMO,omitempty"`
+}
+
+type ofxLedgerBalance struct {
+	XMLName xml.Name `xml:"LEDGERBAL"`
+	BalAmt  string   `xml:"BALAMT"`
+	DTAsOf  string   `xml:"DTASOF"`
+}
+
+type ofxBalance struct {
+	Name    string `xml:"NAME"`
+	Desc    string `xml:"DESC"`
+	BalType string `xml:"BALTYPE"`
+	Value   string `xml:"VALUE"`
+	DTAsOf  string `xml:"DTASOF"`
+}
+
+type ofxBalanceList struct {
+	XMLName  xml.Name     `xml:"BALLIST"`
+	Balances []ofxBalance `xml:"BAL"`
+}
+
+// ofxWriter write an OFX 2.2 bank statement response. OFX has no opening balance element,
+// it goes to BALLIST next to the closing LEDGERBAL.
+type ofxWriter struct {
+	enc  *xml.Encoder
+	info Info
+}
+
+func newOFXWriter(w io.Writer) *ofxWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &ofxWriter{enc: enc}
+}
+
+// ofxTime format time as OFX datetime in UTC
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+func (o *ofxWriter) start(name string) error {
+	return o.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+func (o *ofxWriter) end(name string) error {
+	return o.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (o *ofxWriter) element(name, value string) error {
+	return o.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+func (o *ofxWriter) Begin(info Info) error {
+	o.info = info
+	header := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8" standalone="no"`)},
+		xml.CharData("\n"),
+		xml.ProcInst{Target: "OFX", Inst: []byte(`OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"`)},
+		xml.CharData("\n"),
+	}
+	for _, t := range header {
+		if err := o.enc.EncodeToken(t); err != nil {
+			return err
+		}
+	}
+
+	if err := o.start("OFX"); err != nil {
+		return err
+	}
+	if err := o.start("SIGNONMSGSRSV1"); err != nil {
+		return err
+	}
+	signon := ofxSignon{Status: ofxStatus{Code: 0, Severity: "INFO"}, DTServer: ofxTime(info.CreatedAt), Language: "ENG"}
+	if err := o.enc.Encode(signon); err != nil {
+		return err
+	}
+	if err := o.end("SIGNONMSGSRSV1"); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"BANKMSGSRSV1", "STMTTRNRS"} {
+		if err := o.start(name); err != nil {
+			return err
+		}
+	}
+	if err := o.element("TRNUID", truncate(info.ID, 36)); err != nil {
+		return err
+	}
+	if err := o.enc.EncodeElement(ofxStatus{Code: 0, Severity: "INFO"}, xml.StartElement{Name: xml.Name{Local: "STATUS"}}); err != nil {
+		return err
+	}
+	if err := o.start("STMTRS"); err != nil {
+		return err
+	}
+	if err := o.element("CURDEF", info.Currency); err != nil {
+		return err
+	}
+	if err := o.enc.Encode(ofxAccount{BankID: ofxBankID, AcctID: truncate(info.Account, 22), AcctType: "CHECKING"}); err != nil {
+		return err
+	}
+	if err := o.start("BANKTRANLIST"); err != nil {
+		return err
+	}
+	if err := o.element("DTSTART", ofxTime(info.From)); err != nil {
+		return err
+	}
+	return o.element("DTEND", ofxTime(info.To))
+}
+
+func (o *ofxWriter) Entry(e Entry) error {
+	return o.enc.Encode(ofxTransaction{
+		TrnType:  ofxType(e),
+		DTPosted: ofxTime(e.Time),
+		TrnAmt:   amount(e.Amount),
+		FITID:    strconv.FormatInt(e.ID, 10),
+		Name:     truncate(e.Kind, 32),
+		Memo:     truncate(e.Description, 255),
+	})
+}
+
+func (o *ofxWriter) End() error {
+	if err := o.end("BANKTRANLIST"); err != nil {
+		return err
+	}
+	if err := o.enc.Encode(ofxLedgerBalance{BalAmt: amount(o.info.Closing), DTAsOf: ofxTime(o.info.To)}); err != nil {
+		return err
+	}
+	opening := ofxBalanceList{Balances: []ofxBalance{{
+		Name:    "Opening balance",
+		Desc:    "Balance at the start of the statement period",
+		BalType: "DOLLAR",
+		Value:   amount(o.info.Opening),
+		DTAsOf:  ofxTime(o.info.From),
+	}}}
+	if err := o.enc.Encode(opening); err != nil {
+		return err
+	}
+	for _, name := range []string{"STMTRS", "STMTTRNRS", "BANKMSGSRSV1", "OFX"} {
+		if err := o.end(name); err != nil {
+			return err
+		}
+	}
+	return o.enc.Close()
+}
+
+// ofxType map ledger kind to OFX TRNTYPE
+func ofxType(e Entry) string {
+	switch e.Kind {
+	case "deposit":
+		return "DEP"
+	case "exchange", "transfer":
+		return "XFER"
+	case "capture":
+		return "POS"
+	}
+	if e.Amount < 0 {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+// truncate cut s to n characters, formats limit text fields
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,85 @@
+// Package statement renders account statements as CSV, OFX 2.2 or ISO 20022 camt.053.
+// Writers get the period summary first and then one entry at a time, so a statement
+// of any length is written without holding it in memory.
+package statement
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Supported formats
+const (
+	CSV     = "csv"
+	OFX     = "ofx"
+	Camt053 = "camt053"
+)
+
+// Info describes the statement, it is known before the first entry
+type Info struct {
+	ID          string
+	Account     string
+	Currency    string
+	From        time.Time
+	To          time.Time
+	CreatedAt   time.Time
+	Opening     float64
+	Closing     float64
+	Credits     float64
+	Debits      float64
+	CreditCount int
+	DebitCount  int
+}
+
+// Entry is one booked movement, Amount is negative for debits
+type Entry struct {
+	ID          int64
+	Time        time.Time
+	Kind        string
+	Description string
+	Amount      float64
+}
+
+// Writer writes one statement: Begin once, Entry per movement, then End
+type Writer interface {
+	Begin(info Info) error
+	Entry(e Entry) error
+	End() error
+}
+
+// New create writer of the format
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case OFX:
+		return newOFXWriter(w), nil
+	case Camt053:
+		return newCamtWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown statement format %q", format)
+}
+
+// ContentType return media type and file extension of the format
+func ContentType(format string) (string, string) {
+	switch format {
+	case OFX:
+		return "application/x-ofx", "ofx"
+	case Camt053:
+		return "application/xml", "xml"
+	}
+	return "text/csv; charset=utf-8", "csv"
+}
+
+// amount format money with two decimals, the ledger precision
+func amount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// absAmount format the magnitude for formats carrying the sign separately
+func absAmount(v float64) string {
+	return amount(math.Abs(v))
+}
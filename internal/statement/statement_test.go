@@ -0,0 +1,240 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var formats = []string{CSV, OFX, Camt053}
+
+type statementCase struct {
+	name    string
+	info    Info
+	entries []Entry
+}
+
+func statementCases() []statementCase {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	created := time.Date(2026, 4, 2, 9, 30, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 15, 0, 0, time.UTC) }
+
+	return []statementCase{
+		{
+			name: "empty",
+			info: Info{ID: "stmt-empty", Account: "42-USD", Currency: "USD", From: from, To: to, CreatedAt: created, Opening: 125.5, Closing: 125.5},
+		},
+		{
+			name: "entries",
+			info: Info{
+				ID: "stmt-entries", Account: "42-USD", Currency: "USD", From: from, To: to, CreatedAt: created,
+				Opening: 100, Closing: 264.75, Credits: 260, Debits: 95.25, CreditCount: 2, DebitCount: 2,
+			},
+			entries: []Entry{
+				{ID: 11, Time: at(2, 9), Kind: "deposit", Description: "Salary <March> & bonus", Amount: 250},
+				{ID: 12, Time: at(5, 18), Kind: "withdrawal", Description: `Rent "flat 3", 'A' wing`, Amount: -75.25},
+				{ID: 13, Time: at(9, 12), Kind: "exchange", Description: "USD->EUR at 0.92", Amount: -20},
+				{ID: 14, Time: at(30, 23), Kind: "reversal", Description: "Reversal of 13:\nrate & fee", Amount: 10},
+			},
+		},
+		{
+			name: "negative",
+			info: Info{
+				ID: "stmt-negative", Account: "42-USD", Currency: "USD", From: from, To: to, CreatedAt: created,
+				Opening: -5, Closing: -35, Credits: 20, Debits: 50, CreditCount: 1, DebitCount: 1,
+			},
+			entries: []Entry{
+				{ID: 21, Time: at(3, 10), Kind: "reversal", Description: "Chargeback <case 7>", Amount: -50},
+				{ID: 22, Time: at(4, 11), Kind: "deposit", Amount: 20},
+			},
+		},
+	}
+}
+
+func render(t *testing.T, format string, sc statementCase) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := New(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Begin(sc.info); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range sc.entries {
+		if err := w.Entry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.End(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGolden(t *testing.T) {
+	for _, format := range formats {
+		_, ext := ContentType(format)
+		for _, sc := range statementCases() {
+			t.Run(format+"/"+sc.name, func(t *testing.T) {
+				got := render(t, format, sc)
+				path := filepath.Join("testdata", sc.name+"."+ext)
+				if *update {
+					if err := os.WriteFile(path, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("output differs from %s, run go test -update to see the change:\n%s", path, got)
+				}
+			})
+		}
+	}
+}
+
+// xmlText return the text of every element with the local name, in document order
+func xmlText(t *testing.T, doc []byte, name string) []string {
+	t.Helper()
+
+	var texts []string
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return texts
+		}
+		if err != nil {
+			t.Fatalf("not well-formed XML: %v", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == name {
+			var text string
+			if err := dec.DecodeElement(&text, &start); err != nil {
+				t.Fatal(err)
+			}
+			texts = append(texts, text)
+		}
+	}
+}
+
+func TestDescriptionsRoundTrip(t *testing.T) {
+	for _, sc := range statementCases() {
+		var want []string
+		for _, e := range sc.entries {
+			want = append(want, e.Description)
+		}
+
+		rows, err := csv.NewReader(bytes.NewReader(render(t, CSV, sc))).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: invalid CSV: %v", sc.name, err)
+		}
+		// Header, opening balance, entries, closing balance
+		if len(rows) != len(sc.entries)+3 || rows[1][1] != "opening_balance" || rows[len(rows)-1][1] != "closing_balance" {
+			t.Fatalf("%s: CSV rows = %q", sc.name, rows)
+		}
+		for i, e := range sc.entries {
+			if rows[i+2][3] != e.Description {
+				t.Errorf("%s: CSV description = %q, want %q", sc.name, rows[i+2][3], e.Description)
+			}
+		}
+
+		checkXML := func(format, element string) {
+			got := xmlText(t, render(t, format, sc), element)
+			var nonEmpty []string
+			for _, d := range want {
+				if d != "" {
+					nonEmpty = append(nonEmpty, d)
+				}
+			}
+			if len(got) != len(nonEmpty) {
+				t.Fatalf("%s %s: %s = %q, want %q", sc.name, format, element, got, nonEmpty)
+			}
+			for i := range got {
+				if got[i] != nonEmpty[i] {
+					t.Errorf("%s %s: %s = %q, want %q", sc.name, format, element, got[i], nonEmpty[i])
+				}
+			}
+		}
+		checkXML(OFX, "MEMO")
+		checkXML(Camt053, "AddtlNtryInf")
+	}
+}
+
+func TestCamtBalancesCarryTheSignSeparately(t *testing.T) {
+	for _, sc := range statementCases() {
+		doc := render(t, Camt053, sc)
+		var parsed struct {
+			Balances []struct {
+				Code   string `xml:"Tp>CdOrPrtry>Cd"`
+				Amount string `xml:"Amt"`
+				CdtDbt string `xml:"CdtDbtInd"`
+			} `xml:"BkToCstmrStmt>Stmt>Bal"`
+		}
+		if err := xml.Unmarshal(doc, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		want := [][3]string{
+			{"OPBD", absAmount(sc.info.Opening), creditDebit(sc.info.Opening)},
+			{"CLBD", absAmount(sc.info.Closing), creditDebit(sc.info.Closing)},
+		}
+		if len(parsed.Balances) != 2 {
+			t.Fatalf("%s: balances = %+v", sc.name, parsed.Balances)
+		}
+		for i, b := range parsed.Balances {
+			if got := [3]string{b.Code, b.Amount, b.CdtDbt}; got != want[i] {
+				t.Errorf("%s: balance = %v, want %v", sc.name, got, want[i])
+			}
+		}
+	}
+}
+
+// countingWriter count bytes handed to the underlying writer
+type countingWriter struct{ n int }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func TestWritersStream(t *testing.T) {
+	const entries = 20000
+	info := statementCases()[1].info
+	for _, format := range formats {
+		var out countingWriter
+		w, err := New(format, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Begin(info); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < entries; i++ {
+			e := Entry{ID: int64(i), Time: info.From.Add(time.Duration(i) * time.Minute), Kind: "deposit", Description: "streamed entry", Amount: 1}
+			if err := w.Entry(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		beforeEnd := out.n
+		if err := w.End(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only a small buffer and the closing elements may be left for End
+		if held := out.n - beforeEnd; held > 16<<10 || out.n < entries*50 {
+			t.Errorf("%s: %d of %d bytes were written only at End", format, held, out.n)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gw-currncy-wallet/internal/audit"
+	"gw-currncy-wallet/internal/logging"
+)
+
+// Audited actions
+const (
+	AuditRegister      = "user.registered"
+	AuditLoginSuccess  = "login.succeeded"
+	AuditLoginFailure  = "login.failed"
+	AuditTokenIssued   = "token.issued"
+	AuditDeposit       = "wallet.deposit"
+	AuditWithdrawal    = "wallet.withdrawal"
+	AuditExchange      = "wallet.exchange"
+	AuditAdjustment    = "balance.adjusted"
+	AuditReversal      = "transaction.reversed"
+	AuditHoldPlaced    = "hold.placed"
+	AuditHoldCaptured  = "hold.captured"
+	AuditHoldReleased  = "hold.released"
+	AuditHoldExpired   = "hold.expired"
+	AuditFreeze        = "user.frozen"
+	AuditUnfreeze      = "user.unfrozen"
+	AuditPasswordReset = "user.password_reset"
+	AuditAdminRequest  = "admin.request"
+)
+
+// genesisHash is the prev_hash of the first entry
+var genesisHash = strings.Repeat("0", 64)
+
+// auditLockClass with the hashed chain name serializes appends to one chain,
+// every chain has exactly one head at any time
+const auditLockClass = 0x61756469 // "audi"
+
+// legacyChain holds the entries written before the log was split into chains,
+// their hashes do not cover the chain name
+const legacyChain = "main"
+
+// auditChain pick the chain of a record. Logins and admin requests get chains of their own,
+// so anonymous traffic never waits on a money movement, and every user has a chain.
+func auditChain(r AuditRecord) string {
+	switch {
+	case r.Action == AuditLoginSuccess || r.Action == AuditLoginFailure || r.Action == AuditTokenIssued:
+		return "auth"
+	case r.Action == AuditAdminRequest:
+		return "admin"
+	case r.UserID != nil:
+		return "user:" + strconv.Itoa(*r.UserID)
+	}
+	return "system"
+}
+
+// AuditRecord is what a caller wants to log. Actor and origin of the request are
+// taken from the context unless ActorID is set.
+type AuditRecord struct {
+	Action  string
+	ActorID *int
+	UserID  *int
+	// Balances per currency before and after a money movement
+	Before map[string]float64
+	After  map[string]float64
+	// Anything else worth keeping, encoded as JSON
+	Details map[string]any
+}
+
+// AuditEntry is a stored entry of the audit log
+type AuditEntry struct {
+	ID             int64           `json:"id"`
+	Chain          string          `json:"chain" example:"user:42"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Action         string          `json:"action"`
+	ActorID        *int            `json:"actor_id"`
+	UserID         *int            `json:"user_id"`
+	IP             string          `json:"ip"`
+	UserAgent      string          `json:"user_agent"`
+	RequestID      string          `json:"request_id"`
+	BalancesBefore json.RawMessage `json:"balances_before,omitempty" swaggertype:"object"`
+	BalancesAfter  json.RawMessage `json:"balances_after,omitempty" swaggertype:"object"`
+	Details        json.RawMessage `json:"details" swaggertype:"object"`
+	PrevHash       string          `json:"prev_hash"`
+	Hash           string          `json:"hash"`
+}
+
+// AuditFilter narrows down an audit log query, zero values match everything
+type AuditFilter struct {
+	ActorID   int
+	UserID    int
+	Action    string
+	RequestID string
+	From, To  time.Time
+	// Only entries older than this id, for paging backwards
+	BeforeID int64
+	Limit    int
+}
+
+// AuditBreak is an entry whose hash does not match its content or its predecessor
+type AuditBreak struct {
+	ID     int64  `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// AuditVerification is the result of checking every chain
+type AuditVerification struct {
+	Entries int64 `json:"entries"`
+	Chains  int   `json:"chains"`
+	// Digest of the heads of all chains
+	Head   string       `json:"head"`
+	Breaks []AuditBreak `json:"breaks"`
+}
+
+// auditHash hash the entry together with the hash of its predecessor
+func auditHash(e *AuditEntry) string {
+	// A JSON array keeps field boundaries unambiguous
+	fields := []any{
+		e.PrevHash, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Action, e.ActorID, e.UserID,
+		e.IP, e.UserAgent, e.RequestID, string(e.BalancesBefore), string(e.BalancesAfter), string(e.Details),
+	}
+	if e.Chain != legacyChain {
+		fields = append(fields, e.Chain)
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// headsDigest hash the heads of all chains in chain order into one value to keep elsewhere
+func headsDigest(heads map[string]string) string {
+	if len(heads) == 0 {
+		return genesisHash
+	}
+	chains := make([]string, 0, len(heads))
+	for chain := range heads {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+
+	h := sha256.New()
+	for _, chain := range chains {
+		fmt.Fprintf(h, "%s=%s\n", chain, heads[chain])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// nullableJSON encode balances, nil stays SQL NULL
+func nullableJSON(v map[string]float64) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// appendAudit add the record to its chain inside tx, so it is kept if and only if the
+// audited change is committed. It must be the last write of the transaction: the chain
+// lock is held until commit and nothing else may wait while holding it.
+func appendAudit(ctx context.Context, tx *sql.Tx, r AuditRecord) error {
+	meta := audit.FromContext(ctx)
+	e := AuditEntry{
+		Chain:     auditChain(r),
+		Action:    r.Action,
+		ActorID:   r.ActorID,
+		UserID:    r.UserID,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		RequestID: meta.RequestID,
+	}
+	if e.ActorID == nil {
+		if id, ok := logging.UserID(ctx); ok {
+			e.ActorID = &id
+		}
+	}
+
+	var err error
+	if e.BalancesBefore, err = nullableJSON(r.Before); err != nil {
+		return fmt.Errorf("failed to encode audit balances: %w", err)
+	}
+	if e.BalancesAfter, err = nullableJSON(r.After); err != nil {
+		return fmt.Errorf("failed to encode audit balances: %w", err)
+	}
+	details := r.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	if e.Details, err = json.Marshal(details); err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock($1, hashtext($2))`, auditLockClass, e.Chain); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	err = tx.QueryRowContext(ctx, `select hash from audit_log where chain = $1 order by id desc limit 1`, e.Chain).Scan(&e.PrevHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		e.PrevHash, err = genesisHash, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit head: %w", err)
+	}
+
+	// Postgres keeps microseconds, the hash must cover what is stored
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	e.Hash = auditHash(&e)
+
+	query := `insert into audit_log (chain, created_at, action, actor_id, user_id, ip, user_agent, request_id,
+		balances_before, balances_after, details, prev_hash, hash)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	_, err = tx.ExecContext(ctx, query, e.Chain, e.CreatedAt, e.Action, e.ActorID, e.UserID, e.IP, e.UserAgent, e.RequestID,
+		nullString(e.BalancesBefore), nullString(e.BalancesAfter), string(e.Details), e.PrevHash, e.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return nil
+}
+
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
+
+// Audit append a record which is not part of another change, like a login
+func (s *StorageConn) Audit(ctx context.Context, r AuditRecord) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return appendAudit(ctx, tx, r)
+	})
+}
+
+const auditColumns = `id, chain, created_at, action, actor_id, user_id, ip, user_agent, request_id,
+	balances_before, balances_after, details, prev_hash, hash`
+
+func scanAudit(row scanner, e *AuditEntry) error {
+	var before, after sql.NullString
+	var details string
+	err := row.Scan(&e.ID, &e.Chain, &e.CreatedAt, &e.Action, &e.ActorID, &e.UserID, &e.IP, &e.UserAgent, &e.RequestID,
+		&before, &after, &details, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return err
+	}
+	if before.Valid {
+		e.BalancesBefore = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		e.BalancesAfter = json.RawMessage(after.String)
+	}
+	e.Details = json.RawMessage(details)
+	return nil
+}
+
+// AuditLog return entries matching the filter, newest first
+func (s *StorageConn) AuditLog(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	query := `select ` + auditColumns + `
+	from audit_log
+	where ($1 = 0 or actor_id = $1)
+		and ($2 = 0 or user_id = $2)
+		and ($3 = '' or action = $3)
+		and ($4 = '' or request_id = $4)
+		and ($5::timestamptz is null or created_at >= $5)
+		and ($6::timestamptz is null or created_at < $6)
+		and ($7 = 0 or id < $7)
+	order by id desc
+	limit $8`
+
+	rows, err := s.DB.QueryContext(ctx, query, f.ActorID, f.UserID, f.Action, f.RequestID,
+		nullTime(f.From), nullTime(f.To), f.BeforeID, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanAudit(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// VerifyAudit walk every chain from its first entry and recompute every hash.
+// A deleted tail can not be detected from the log alone, compare Head with a copy kept elsewhere.
+func (s *StorageConn) VerifyAudit(ctx context.Context) (*AuditVerification, error) {
+	rows, err := s.DB.QueryContext(ctx, `select `+auditColumns+` from audit_log order by chain, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer rows.Close()
+
+	v := &AuditVerification{Breaks: []AuditBreak{}}
+	heads := make(map[string]string)
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanAudit(rows, &e); err != nil {
+			return nil, err
+		}
+		v.Entries++
+
+		head, ok := heads[e.Chain]
+		if !ok {
+			head = genesisHash
+		}
+		if e.PrevHash != head {
+			v.Breaks = append(v.Breaks, AuditBreak{ID: e.ID, Reason: "previous hash does not match, entries were removed or inserted before it"})
+		}
+		if auditHash(&e) != e.Hash {
+			v.Breaks = append(v.Breaks, AuditBreak{ID: e.ID, Reason: "content does not match its hash"})
+		}
+		// Continue from the stored hash, so one edit is reported once and not for every later entry
+		heads[e.Chain] = e.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	v.Chains = len(heads)
+	v.Head = headsDigest(heads)
+	return v, nil
+}
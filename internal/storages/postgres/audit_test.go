@@ -0,0 +1,23 @@
+package postgres
+
+import "testing"
+
+func TestAuditChain(t *testing.T) {
+	userID := 42
+	tests := []struct {
+		record AuditRecord
+		chain  string
+	}{
+		{AuditRecord{Action: AuditLoginFailure}, "auth"},
+		{AuditRecord{Action: AuditLoginSuccess, UserID: &userID}, "auth"},
+		{AuditRecord{Action: AuditTokenIssued, UserID: &userID}, "auth"},
+		{AuditRecord{Action: AuditAdminRequest, UserID: &userID}, "admin"},
+		{AuditRecord{Action: AuditDeposit, UserID: &userID}, "user:42"},
+		{AuditRecord{Action: AuditHoldExpired}, "system"},
+	}
+	for _, tt := range tests {
+		if got := auditChain(tt.record); got != tt.chain {
+			t.Errorf("auditChain(%s) = %q, want %q", tt.record.Action, got, tt.chain)
+		}
+	}
+}
@@ -1,46 +1,130 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"gw-currncy-wallet/pkg/env"
-	"log"
-	"os"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"gw-currncy-wallet/internal/config"
+
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func Connection() (*sql.DB, error) {
-	err := env.LoadConfig("../config.env")
+// Connection open the connection pool and wait until Postgres answers,
+// retrying with backoff while it is still starting
+func Connection(ctx context.Context, cfg config.Database) (*sql.DB, error) {
+	dsn, err := dataSourceName(cfg)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-
-	USERNAME_DB := os.Getenv("USERNAME_DB")
-	PASSWORD_DB := os.Getenv("PASSWORD_DB")
-	DATABASE := os.Getenv("DATABASE")
-	SSL := os.Getenv("SSL")
-	HOST_DB := os.Getenv("HOST_DB")
-	PORT_DB := os.Getenv("PORT_DB")
-
-	if USERNAME_DB == "" || PASSWORD_DB == "" || DATABASE == "" || SSL == "" || HOST_DB == "" || PORT_DB == "" {
-		return nil, fmt.Errorf("missing required environment variables")
+		return nil, err
 	}
 
-	conString := fmt.Sprintf(
-		"host=%s port=%s user=%s sslmode=%s password=%s dbname=%s",
-		HOST_DB, PORT_DB, USERNAME_DB, SSL,
-		PASSWORD_DB, DATABASE,
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true}),
 	)
-
-	db, err := sql.Open("postgres", conString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	target := describe(cfg)
+	backoff := cfg.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		err = db.PingContext(ctx)
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectRetries || ctx.Err() != nil {
+			db.Close()
+			return nil, fmt.Errorf("database is unreachable after %d attempts: %v", attempt+1, err)
+		}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("database is unreachable: %v", err)
+		slog.Warn("database is not reachable yet, retrying", "target", target, "attempt", attempt+1, "delay", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("database is unreachable: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if cfg.ConnectMaxBackoff > 0 && backoff > cfg.ConnectMaxBackoff {
+			backoff = cfg.ConnectMaxBackoff
+		}
 	}
-	fmt.Println("Successfully connected to PostgreSQL!")
+
+	slog.Info("connected to PostgreSQL", "target", target, "max_open_conns", cfg.MaxOpenConns, "statement_timeout", cfg.StatementTimeout)
 	return db, nil
 }
+
+// dataSourceName build lib/pq DSN. Unknown parameters such as statement_timeout
+// are sent to the server as session settings, so every pooled connection gets them.
+func dataSourceName(cfg config.Database) (string, error) {
+	timeout := ""
+	if cfg.StatementTimeout > 0 {
+		timeout = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if cfg.URL != "" {
+		if !strings.HasPrefix(cfg.URL, "postgres://") && !strings.HasPrefix(cfg.URL, "postgresql://") {
+			// key=value DSN
+			if timeout != "" && !strings.Contains(cfg.URL, "statement_timeout=") {
+				return cfg.URL + " statement_timeout=" + timeout, nil
+			}
+			return cfg.URL, nil
+		}
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid database URL: %v", err)
+		}
+		q := u.Query()
+		if timeout != "" && q.Get("statement_timeout") == "" {
+			q.Set("statement_timeout", timeout)
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	params := []string{
+		"host=" + quoteValue(cfg.Host),
+		"port=" + strconv.Itoa(cfg.Port),
+		"user=" + quoteValue(cfg.User),
+		"password=" + quoteValue(cfg.Password),
+		"dbname=" + quoteValue(cfg.Name),
+		"sslmode=" + quoteValue(cfg.SSLMode),
+	}
+	if timeout != "" {
+		params = append(params, "statement_timeout="+timeout)
+	}
+	return strings.Join(params, " "), nil
+}
+
+// quoteValue quote DSN value so passwords with spaces or quotes survive
+func quoteValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// describe return database location for logs, without the password
+func describe(cfg config.Database) string {
+	if cfg.URL == "" {
+		return fmt.Sprintf("%s:%d/%s", cfg.Host, cfg.Port, cfg.Name)
+	}
+	if u, err := url.Parse(cfg.URL); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+	return "DATABASE_URL"
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDSNEnv names the database the storage tests run against. They write real rows,
+// so it must point at a throwaway database, the tests are skipped without it.
+const testDSNEnv = "WALLET_TEST_DSN"
+
+// testStorage connect to the test database and migrate it
+func testStorage(t *testing.T) *StorageConn {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	return &StorageConn{DB: db, Currencies: []string{"USD", "EUR", "RUB"}}
+}
+
+// testUser create a user funded with seed in every currency of the default pocket
+func testUser(t *testing.T, s *StorageConn, seed float64) int {
+	t.Helper()
+
+	ctx := context.Background()
+	name := fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano())
+	userID, err := s.CreateUser(ctx, name, name+"@test.invalid", "not a hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, currency := range s.Currencies {
+		if _, err := s.AdjustBalance(ctx, userID, 0, currency, seed, "test seed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userID
+}
+
+// ledgerTotals return the wallet totals of a user and the sums of their ledger entries per currency
+func ledgerTotals(t *testing.T, s *StorageConn, userID int) (wallets, ledger map[string]float64) {
+	t.Helper()
+
+	ctx := context.Background()
+	wallets, ledger = make(map[string]float64), make(map[string]float64)
+	err := eachRow(ctx, s.DB, `select currency, sum(amount) from wallet where user_id = $1 group by currency`, []any{userID}, func(rows *sql.Rows) error {
+		var currency string
+		var amount float64
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return err
+		}
+		wallets[currency] = amount
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eachRow(ctx, s.DB, `select currency, sum(amount) from transactions where user_id = $1 group by currency`, []any{userID}, func(rows *sql.Rows) error {
+		var currency string
+		var amount float64
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return err
+		}
+		ledger[currency] = amount
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallets, ledger
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"gw-currncy-wallet/internal/changer"
+)
+
+// SaveHalt persist a rate guard halt, a newer halt of the pair replaces the stored one
+func (s *StorageConn) SaveHalt(ctx context.Context, halt changer.Halt) error {
+	// Postgres can not take an infinite quote, the reason still tells what it was
+	rejected := halt.RejectedRate
+	if math.IsInf(rejected, 0) {
+		rejected = math.NaN()
+	}
+
+	query := `insert into rate_halts (from_currency, to_currency, source, rejected_rate, last_rate, reason, halted_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (from_currency, to_currency) do update
+		set source = excluded.source, rejected_rate = excluded.rejected_rate, last_rate = excluded.last_rate,
+			reason = excluded.reason, halted_at = excluded.halted_at`
+
+	_, err := s.DB.ExecContext(ctx, query, halt.FromCurrency, halt.ToCurrency, halt.Source, rejected, halt.LastRate, halt.Reason, halt.HaltedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save rate halt: %w", err)
+	}
+	return nil
+}
+
+// DeleteHalt remove the persisted halt of a pair, a missing one is not an error
+func (s *StorageConn) DeleteHalt(ctx context.Context, fromCurrency, toCurrency string) error {
+	_, err := s.DB.ExecContext(ctx, `delete from rate_halts where from_currency = $1 and to_currency = $2`, fromCurrency, toCurrency)
+	if err != nil {
+		return fmt.Errorf("failed to delete rate halt: %w", err)
+	}
+	return nil
+}
+
+// LoadHalts return all persisted rate guard halts, oldest first
+func (s *StorageConn) LoadHalts(ctx context.Context) ([]changer.Halt, error) {
+	rows, err := s.DB.QueryContext(ctx, `select from_currency, to_currency, source, rejected_rate, last_rate, reason, halted_at
+		from rate_halts order by halted_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate halts: %w", err)
+	}
+	defer rows.Close()
+
+	var halts []changer.Halt
+	for rows.Next() {
+		var h changer.Halt
+		if err := rows.Scan(&h.FromCurrency, &h.ToCurrency, &h.Source, &h.RejectedRate, &h.LastRate, &h.Reason, &h.HaltedAt); err != nil {
+			return nil, err
+		}
+		halts = append(halts, h)
+	}
+	return halts, rows.Err()
+}
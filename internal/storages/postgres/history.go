@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// snapshotLockKey keeps one snapshot job at a time across all instances
+const snapshotLockKey = 0x736e617073686f74 // "snapshot"
+
+// snapshotsPerRun bounds how many missing days one run catches up
+const snapshotsPerRun = 31
+
+// WalletBalance is the balance of one wallet at a moment of a report
+type WalletBalance struct {
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	PocketID int64   `json:"pocket_id"`
+	Pocket   string  `json:"pocket"`
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+}
+
+// asOfBound turn an inclusive moment into the exclusive bound used by the ledger queries.
+// Postgres stores microseconds, so everything up to the end of that microsecond counts.
+func asOfBound(asOf time.Time) time.Time {
+	return asOf.Truncate(time.Microsecond).Add(time.Microsecond)
+}
+
+// BalanceAsOf return total, available and held amount per currency of the pocket as they were
+// at asOf, pocket 0 is the default pocket. Totals come from the latest daily snapshot plus the
+// ledger entries after it, held funds from the holds active at that moment.
+func (s *StorageConn) BalanceAsOf(ctx context.Context, userID int, pocketID int64, asOf time.Time) (map[string]Balance, error) {
+	pocket, err := resolvePocket(ctx, s.DB, userID, pocketID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `with snap as (
+		select max(taken_at) as taken_at from balance_snapshot_runs where taken_at <= $2
+	), historical as (
+		select w.currency,
+			coalesce((select b.amount from balance_snapshots b
+				where b.taken_at = snap.taken_at and b.pocket_id = w.pocket_id and b.currency = w.currency), 0)
+			+ coalesce((select sum(t.amount) from transactions t
+				where t.pocket_id = w.pocket_id and t.currency = w.currency
+					and t.created_at >= coalesce(snap.taken_at, '-infinity') and t.created_at < $2), 0) as total,
+			coalesce((select sum(h.amount) from holds h
+				where h.pocket_id = w.pocket_id and h.currency = w.currency
+					and h.created_at < $2 and (h.status = 'active' or h.updated_at >= $2)), 0) as held
+		from wallet w, snap
+		where w.pocket_id = $1
+	)
+	select currency, total, total - held, held from historical`
+
+	rows, err := s.DB.QueryContext(ctx, query, pocket, asOfBound(asOf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read historical balance: %w", err)
+	}
+	defer rows.Close()
+
+	balance := make(map[string]Balance)
+	for rows.Next() {
+		var currency string
+		var b Balance
+		if err := rows.Scan(&currency, &b.Total, &b.Available, &b.Held); err != nil {
+			return nil, err
+		}
+		balance[currency] = b
+	}
+	return balance, rows.Err()
+}
+
+// BalancesBefore call fn with every non-zero wallet balance built from the ledger entries created
+// before the moment, ordered by user, pocket and currency. Month-end reports pass the first
+// instant of the next month, which is a snapshot boundary, so they read the snapshot alone.
+func (s *StorageConn) BalancesBefore(ctx context.Context, before time.Time, fn func(WalletBalance) error) error {
+	query := `with snap as (
+		select max(taken_at) as taken_at from balance_snapshot_runs where taken_at <= $1
+	), balances as (
+		select pocket_id, currency, sum(amount) as amount
+		from (
+			select b.pocket_id, b.currency, b.amount
+			from balance_snapshots b join snap on b.taken_at = snap.taken_at
+			union all
+			select t.pocket_id, t.currency, t.amount
+			from transactions t, snap
+			where t.created_at >= coalesce(snap.taken_at, '-infinity') and t.created_at < $1
+		) movements
+		group by pocket_id, currency
+		having sum(amount) <> 0
+	)
+	select p.user_id, u.username, b.pocket_id, p.name, b.currency, b.amount
+	from balances b
+	join pockets p on p.id = b.pocket_id
+	join users u on u.id = p.user_id
+	order by p.user_id, b.pocket_id, b.currency`
+
+	rows, err := s.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return fmt.Errorf("failed to read balances: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b WalletBalance
+		if err := rows.Scan(&b.UserID, &b.Username, &b.PocketID, &b.Pocket, &b.Currency, &b.Amount); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// TakeSnapshots snapshot every UTC midnight which passed more than delay ago and has no snapshot
+// yet, up to snapshotsPerRun of them. Each snapshot builds on the previous one. Return how many were taken.
+func (s *StorageConn) TakeSnapshots(ctx context.Context, delay time.Duration) (int, error) {
+	count := 0
+	for count < snapshotsPerRun {
+		taken, err := s.takeSnapshot(ctx, time.Now().Add(-delay))
+		if err != nil || !taken {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// takeSnapshot snapshot the midnight after the latest snapshot if it is not after until
+func (s *StorageConn) takeSnapshot(ctx context.Context, until time.Time) (bool, error) {
+	taken := false
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		taken = false
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `select pg_try_advisory_xact_lock($1)`, snapshotLockKey).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to lock snapshots: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		var last, first sql.NullTime
+		if err := tx.QueryRowContext(ctx, `select max(taken_at) from balance_snapshot_runs`).Scan(&last); err != nil {
+			return fmt.Errorf("failed to find last snapshot: %w", err)
+		}
+		var next time.Time
+		if last.Valid {
+			next = last.Time.UTC().AddDate(0, 0, 1)
+		} else {
+			// The first snapshot is the midnight after the first ledger entry
+			if err := tx.QueryRowContext(ctx, `select min(created_at) from transactions`).Scan(&first); err != nil {
+				return fmt.Errorf("failed to find first transaction: %w", err)
+			}
+			if !first.Valid {
+				return nil
+			}
+			next = first.Time.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+		}
+		if next.After(until) {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `insert into balance_snapshot_runs (taken_at, wallets) values ($1, 0)`, next); err != nil {
+			return fmt.Errorf("failed to start snapshot: %w", err)
+		}
+		query := `insert into balance_snapshots (taken_at, pocket_id, currency, amount)
+		select $1, pocket_id, currency, sum(amount)
+		from (
+			select pocket_id, currency, amount from balance_snapshots where taken_at = $2
+			union all
+			select pocket_id, currency, amount from transactions
+			where created_at >= coalesce($2, '-infinity'::timestamptz) and created_at < $1
+		) movements
+		group by pocket_id, currency
+		having sum(amount) <> 0`
+		result, err := tx.ExecContext(ctx, query, next, last)
+		if err != nil {
+			return fmt.Errorf("failed to take snapshot: %w", err)
+		}
+		wallets, _ := result.RowsAffected()
+		if _, err := tx.ExecContext(ctx, `update balance_snapshot_runs set wallets = $2 where taken_at = $1`, next, wallets); err != nil {
+			return fmt.Errorf("failed to finish snapshot: %w", err)
+		}
+		taken = true
+		return nil
+	})
+	return taken, err
+}
+
+// RunSnapshotter take missing daily snapshots every interval until ctx is done
+func (s *StorageConn) RunSnapshotter(ctx context.Context, interval, delay time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.TakeSnapshots(ctx, delay)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("balance snapshot failed", "error", err)
+			}
+			if n > 0 {
+				slog.Info("balance snapshots taken", "count", n)
+			}
+		}
+	}
+}
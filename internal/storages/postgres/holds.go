@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// Hold statuses
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+// Hold reserves funds of a wallet until it is captured, released or expires
+type Hold struct {
+	ID          int64     `json:"id"`
+	UserID      int       `json:"user_id"`
+	PocketID    int64     `json:"pocket_id"`
+	Currency    string    `json:"currency"`
+	Amount      float64   `json:"amount"`
+	Captured    float64   `json:"captured"`
+	Status      string    `json:"status"`
+	Description string    `json:"description,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Balance of one currency, Available excludes held funds
+type Balance struct {
+	Total     float64 `json:"total"`
+	Available float64 `json:"available"`
+	Held      float64 `json:"held"`
+}
+
+const holdColumns = `id, user_id, pocket_id, currency, amount, captured, status, coalesce(description, ''), expires_at, created_at, updated_at`
+
+func scanHold(row scanner, h *Hold) error {
+	return row.Scan(&h.ID, &h.UserID, &h.PocketID, &h.Currency, &h.Amount, &h.Captured, &h.Status, &h.Description, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt)
+}
+
+// PlaceHold reserve amount of the pocket wallet until expiresAt, lowering available but not total balance.
+// Pocket 0 is the default pocket.
+func (s *StorageConn) PlaceHold(ctx context.Context, userID int, pocketID int64, currency string, amount float64, expiresAt time.Time, description string) (*Hold, error) {
+	var hold Hold
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+		if err != nil {
+			return err
+		}
+		balances, err := lockWallets(ctx, tx, pocket, currency)
+		if err != nil {
+			return err
+		}
+		if balances[currency] < amount {
+			return apperr.ErrInsufficientFunds
+		}
+
+		query := `update wallet
+		set held = held + $1
+		where pocket_id = $2 and currency = $3 and amount - held >= $1
+		returning amount, held;`
+		var after walletFunds
+		err = tx.QueryRowContext(ctx, query, amount, pocket, currency).Scan(&after.amount, &after.held)
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperr.ErrInsufficientFunds
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reserve funds: %w", err)
+		}
+
+		query = `insert into holds (user_id, pocket_id, currency, amount, description, expires_at)
+		values ($1, $2, $3, $4, nullif($5, ''), $6)
+		returning ` + holdColumns
+		if err := scanHold(tx.QueryRowContext(ctx, query, userID, pocket, currency, amount, description, expiresAt), &hold); err != nil {
+			return err
+		}
+		before := walletFunds{amount: after.amount, held: after.held - amount}
+		return recordHoldChange(ctx, tx, AuditHoldPlaced, EventHoldPlaced, &hold, nil, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// lockHold lock the hold of the user. Holds are always locked before wallets.
+func lockHold(ctx context.Context, tx *sql.Tx, userID int, holdID int64) (*Hold, error) {
+	var hold Hold
+	query := `select ` + holdColumns + ` from holds where id = $1 and user_id = $2 for update`
+	err := scanHold(tx.QueryRowContext(ctx, query, holdID, userID), &hold)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", apperr.ErrHoldNotFound, holdID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock hold: %w", err)
+	}
+	return &hold, nil
+}
+
+// CaptureHold settle the hold. Amount 0 captures the full hold, a smaller amount
+// captures part of it and releases the rest. Return the updated hold and its ledger entry.
+func (s *StorageConn) CaptureHold(ctx context.Context, userID int, holdID int64, amount float64) (*Hold, *Transaction, error) {
+	var (
+		hold *Hold
+		t    *Transaction
+	)
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		var err error
+		hold, err = lockHold(ctx, tx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		if hold.Status != HoldActive || !hold.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("%w: hold %d is %s", apperr.ErrHoldNotActive, holdID, holdState(hold))
+		}
+
+		capture := amount
+		if capture == 0 {
+			capture = hold.Amount
+		}
+		if capture < 0 || capture > hold.Amount {
+			return apperr.Invalid("capture amount must be between 0 and the held %.2f", hold.Amount)
+		}
+		if _, err := lockWallets(ctx, tx, hold.PocketID, hold.Currency); err != nil {
+			return err
+		}
+
+		// A forced reversal may have taken the held funds, an overdrawn wallet is not debited further
+		query := `update wallet
+		set amount = amount - $1, held = held - $2, overdrawn = overdrawn and amount - $1 < held - $2
+		where pocket_id = $3 and currency = $4 and amount - $1 >= 0
+		returning amount, held;`
+		var after walletFunds
+		err = tx.QueryRowContext(ctx, query, capture, hold.Amount, hold.PocketID, hold.Currency).Scan(&after.amount, &after.held)
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperr.ErrInsufficientFunds
+		}
+		if err != nil {
+			return fmt.Errorf("failed to capture hold: %w", err)
+		}
+
+		t = &Transaction{UserID: userID, PocketID: hold.PocketID, Currency: hold.Currency, Kind: TxCapture, Amount: -capture, BalanceAfter: after.amount, HoldID: &hold.ID}
+		if err := recordTx(ctx, tx, t); err != nil {
+			return err
+		}
+		if err := finishHold(ctx, tx, hold, HoldCaptured, -t.Amount); err != nil {
+			return err
+		}
+		before := walletFunds{amount: after.amount + capture, held: after.held + hold.Amount}
+		return recordHoldChange(ctx, tx, AuditHoldCaptured, EventHoldCaptured, hold, t, before, after)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hold, t, nil
+}
+
+// ReleaseHold cancel an active hold and return its funds to the available balance
+func (s *StorageConn) ReleaseHold(ctx context.Context, userID int, holdID int64) (*Hold, error) {
+	var hold *Hold
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		hold, err = lockHold(ctx, tx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		if hold.Status != HoldActive {
+			return fmt.Errorf("%w: hold %d is %s", apperr.ErrHoldNotActive, holdID, hold.Status)
+		}
+		return releaseHold(ctx, tx, hold, HoldReleased)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func releaseHold(ctx context.Context, tx *sql.Tx, hold *Hold, status string) error {
+	if _, err := lockWallets(ctx, tx, hold.PocketID, hold.Currency); err != nil {
+		return err
+	}
+	query := `update wallet
+	set held = held - $1, overdrawn = overdrawn and amount < held - $1
+	where pocket_id = $2 and currency = $3
+	returning amount, held;`
+	var after walletFunds
+	if err := tx.QueryRowContext(ctx, query, hold.Amount, hold.PocketID, hold.Currency).Scan(&after.amount, &after.held); err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+	if err := finishHold(ctx, tx, hold, status, 0); err != nil {
+		return err
+	}
+
+	action, event := AuditHoldReleased, EventHoldReleased
+	if status == HoldExpired {
+		action, event = AuditHoldExpired, EventHoldExpired
+	}
+	before := walletFunds{amount: after.amount, held: after.held + hold.Amount}
+	return recordHoldChange(ctx, tx, action, event, hold, nil, before, after)
+}
+
+// walletFunds is the total and the held part of one wallet
+type walletFunds struct {
+	amount, held float64
+}
+
+// recordHoldChange notify webhooks and log a hold transition with the wallet funds around it.
+// Held funds are logged next to the total under "<currency>:held".
+func recordHoldChange(ctx context.Context, tx *sql.Tx, action, event string, hold *Hold, t *Transaction, before, after walletFunds) error {
+	if err := enqueueEvent(ctx, tx, hold.UserID, event, HoldEvent{Hold: *hold, Transaction: t}); err != nil {
+		return err
+	}
+
+	held := hold.Currency + ":held"
+	details := map[string]any{"hold_id": hold.ID, "pocket_id": hold.PocketID, "currency": hold.Currency, "amount": hold.Amount}
+	if t != nil {
+		details["captured"] = -t.Amount
+		details["transaction_id"] = t.ID
+	}
+	return appendAudit(ctx, tx, AuditRecord{
+		Action:  action,
+		UserID:  &hold.UserID,
+		Before:  map[string]float64{hold.Currency: before.amount, held: before.held},
+		After:   map[string]float64{hold.Currency: after.amount, held: after.held},
+		Details: details,
+	})
+}
+
+func finishHold(ctx context.Context, tx *sql.Tx, hold *Hold, status string, captured float64) error {
+	query := `update holds
+	set status = $1, captured = $2, updated_at = now()
+	where id = $3
+	returning ` + holdColumns
+	return scanHold(tx.QueryRowContext(ctx, query, status, captured, hold.ID), hold)
+}
+
+// holdState describe why the hold can not be captured
+func holdState(h *Hold) string {
+	if h.Status == HoldActive {
+		return HoldExpired
+	}
+	return h.Status
+}
+
+// Holds return holds of the user, newest first, status "" lists all
+func (s *StorageConn) Holds(ctx context.Context, userID int, status string, limit int) ([]Hold, error) {
+	query := `select ` + holdColumns + `
+	from holds
+	where user_id = $1 and ($2 = '' or status = $2)
+	order by created_at desc, id desc
+	limit $3`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []Hold{}
+	for rows.Next() {
+		var h Hold
+		if err := scanHold(rows, &h); err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+// ExpireHolds release up to limit active holds whose expiry passed, return how many expired
+func (s *StorageConn) ExpireHolds(ctx context.Context, limit int) (int, error) {
+	query := `select id, user_id from holds
+	where status = 'active' and expires_at <= now()
+	order by expires_at
+	limit $1`
+
+	rows, err := s.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired holds: %w", err)
+	}
+	type due struct {
+		id     int64
+		userID int
+	}
+	var expired []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, d := range expired {
+		// One transaction per hold, a capture racing the sweeper simply wins or loses the row lock
+		released := false
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			hold, err := lockHold(ctx, tx, d.userID, d.id)
+			if err != nil {
+				return err
+			}
+			if hold.Status != HoldActive || hold.ExpiresAt.After(time.Now()) {
+				released = false
+				return nil
+			}
+			released = true
+			return releaseHold(ctx, tx, hold, HoldExpired)
+		})
+		if err != nil {
+			return count, err
+		}
+		if released {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RunHoldSweeper expire overdue holds every interval until ctx is done
+func (s *StorageConn) RunHoldSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.ExpireHolds(ctx, 500)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("hold sweeper failed", "error", err)
+			}
+			if n > 0 {
+				slog.Info("expired holds released", "count", n)
+			}
+		}
+	}
+}
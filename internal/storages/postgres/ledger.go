@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// Kinds of ledger entries
+const (
+	TxOpening    = "opening"
+	TxDeposit    = "deposit"
+	TxWithdrawal = "withdrawal"
+	TxExchange   = "exchange"
+	TxAdjustment = "adjustment"
+	TxCapture    = "capture"
+	TxTransfer   = "transfer"
+	TxReversal   = "reversal"
+)
+
+// Transaction is one ledger entry, Amount is negative for debits
+type Transaction struct {
+	ID           int64    `json:"id"`
+	UserID       int      `json:"user_id"`
+	PocketID     int64    `json:"pocket_id"`
+	Currency     string   `json:"currency"`
+	Kind         string   `json:"kind"`
+	Amount       float64  `json:"amount"`
+	BalanceAfter float64  `json:"balance_after"`
+	Rate         *float64 `json:"rate,omitempty"`
+	RelatedID    *int64   `json:"related_id,omitempty"`
+	HoldID       *int64   `json:"hold_id,omitempty"`
+	// Entry this one compensates, set on reversal entries
+	ReversalOf *int64 `json:"reversal_of,omitempty"`
+	// Reversal entry compensating this one, set once it is reversed
+	ReversedBy *int64    `json:"reversed_by,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// transactionColumns is the select list matching scanTransaction
+const transactionColumns = `id, user_id, pocket_id, currency, kind, amount, balance_after, rate, related_id, hold_id, reversal_of,
+	(select r.id from transactions r where r.reversal_of = transactions.id), coalesce(reason, ''), created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransaction(row scanner, t *Transaction) error {
+	return row.Scan(&t.ID, &t.UserID, &t.PocketID, &t.Currency, &t.Kind, &t.Amount, &t.BalanceAfter, &t.Rate, &t.RelatedID, &t.HoldID, &t.ReversalOf, &t.ReversedBy, &t.Reason, &t.CreatedAt)
+}
+
+// checkNotFrozen lock the user row for the transaction and fail if the account is frozen
+func checkNotFrozen(ctx context.Context, tx *sql.Tx, userID int) error {
+	var frozen bool
+	err := tx.QueryRowContext(ctx, `select frozen from users where id = $1 for share`, userID).Scan(&frozen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user: %w", err)
+	}
+	if frozen {
+		return apperr.ErrAccountFrozen
+	}
+	return nil
+}
+
+// recordTx append ledger entry inside the transaction which changed the balance
+func recordTx(ctx context.Context, tx *sql.Tx, t *Transaction) error {
+	query := `insert into transactions (user_id, pocket_id, currency, kind, amount, balance_after, rate, related_id, hold_id, reversal_of, reason)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, nullif($11, ''))
+	returning id, amount, created_at`
+
+	err := tx.QueryRowContext(ctx, query, t.UserID, t.PocketID, t.Currency, t.Kind, t.Amount, t.BalanceAfter, t.Rate, t.RelatedID, t.HoldID, t.ReversalOf, t.Reason).
+		Scan(&t.ID, &t.Amount, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record transaction: %w", err)
+	}
+	return nil
+}
+
+// AdjustBalance post manual correction by an operator. Amount is signed,
+// the balance can not go below zero. Adjustments are allowed on frozen accounts.
+// Pocket 0 is the default pocket.
+func (s *StorageConn) AdjustBalance(ctx context.Context, userID int, pocketID int64, currency string, amount float64, reason string) (*Transaction, error) {
+	if reason == "" {
+		return nil, apperr.Invalid("adjustment reason is required")
+	}
+
+	var t *Transaction
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+		if err != nil {
+			return err
+		}
+		balances, err := lockWallets(ctx, tx, pocket, currency)
+		if err != nil {
+			return err
+		}
+		if balances[currency]+amount < 0 {
+			return apperr.ErrInsufficientFunds
+		}
+
+		balance, err := addToWallet(ctx, tx, pocket, currency, amount)
+		if err != nil {
+			return err
+		}
+		t = &Transaction{UserID: userID, PocketID: pocket, Currency: currency, Kind: TxAdjustment, Amount: amount, BalanceAfter: balance, Reason: reason}
+		if err := recordTx(ctx, tx, t); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, AuditRecord{
+			Action:  AuditAdjustment,
+			UserID:  &userID,
+			Before:  map[string]float64{currency: balance - amount},
+			After:   map[string]float64{currency: balance},
+			Details: map[string]any{"pocket_id": pocket, "currency": currency, "amount": amount, "reason": reason, "transaction_id": t.ID},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RecentTransactions return latest ledger entries, userID 0 lists all users
+func (s *StorageConn) RecentTransactions(ctx context.Context, userID, limit int) ([]Transaction, error) {
+	query := `select ` + transactionColumns + `
+	from transactions
+	where $1 = 0 or user_id = $1
+	order by created_at desc, id desc
+	limit $2`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	txs := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
+
+// SetFrozen freeze or unfreeze the account
+func (s *StorageConn) SetFrozen(ctx context.Context, userID int, frozen bool) error {
+	action := AuditUnfreeze
+	if frozen {
+		action = AuditFreeze
+	}
+	return s.updateUser(ctx, userID, action, `update users set frozen = $1 where id = $2`, frozen)
+}
+
+// SetPassword replace the password hash of the user
+func (s *StorageConn) SetPassword(ctx context.Context, userID int, hashedPassword string) error {
+	return s.updateUser(ctx, userID, AuditPasswordReset, `update users set password = $1 where id = $2`, hashedPassword)
+}
+
+// updateUser run an update of one user taking the value as $1 and the id as $2, and audit it
+func (s *StorageConn) updateUser(ctx context.Context, userID int, action, query string, value any) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, value, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return apperr.ErrUserNotFound
+		}
+		return appendAudit(ctx, tx, AuditRecord{Action: action, UserID: &userID})
+	})
+}
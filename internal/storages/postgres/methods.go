@@ -1,15 +1,18 @@
 package postgres
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+
+	"gw-currncy-wallet/internal/apperr"
 )
 
 type StorageConn struct {
 	DB *sql.DB
+	// Currencies get a wallet row for every new user
+	Currencies []string
 }
 
 type User struct {
@@ -17,129 +20,211 @@ type User struct {
 	Username string
 	Email    string
 	Password string
+	Frozen   bool
 }
 
 func (s *StorageConn) CreateUser(ctx context.Context, username, email, hashedPassword string) (int, error) {
-	// Start transaction
-	tx, err := s.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to start transaction: %v", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	//Creatinmg User
 	var userID int
-	query := `insert Into public.users (username, email, password)
-	values ($1, $2, $3)
-	returning id;`
-
-	type checkPar struct {
-		username string
-		email    string
-	}
-	var check checkPar
-
-	//Check existing username or email
-	checkString := s.DB.QueryRowContext(ctx, "select from public.users where username = $1 and email = $2", username, email)
-	err = checkString.Scan(&check.username, &check.email)
-	if err == sql.ErrNoRows {
-
-	} else if err != nil {
-		return 0, fmt.Errorf("failed to execute check user request: %v", err)
-	}
-	if check.username == username || check.email == email {
-		file, _ := os.Open("../666.txt")
-		scanner := bufio.NewScanner(file)
-		defer file.Close()
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
-		}
-		return 666, fmt.Errorf("username or email already exists")
-	}
-	err = s.DB.QueryRowContext(ctx, query, username, email, hashedPassword).Scan(&userID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute create user request: %v", err)
-	}
-
-	//Creating wallet
-	currencies := []string{"USD", "EUR", "RUB"}
-	for _, currency := range currencies {
-		query = `
-			INSERT INTO wallet (user_id, currency, amount)
-			VALUES ($1, $2, 0);
-		`
-		_, err := tx.ExecContext(ctx, query, userID, currency)
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// Creating user, the unique constraints catch taken usernames and emails
+		query := `insert into users (username, email, password)
+		values ($1, $2, $3)
+		returning id;`
+		err := tx.QueryRowContext(ctx, query, username, email, hashedPassword).Scan(&userID)
+		if isUniqueViolation(err) {
+			return apperr.ErrDuplicateUser
+		}
 		if err != nil {
-			return 0, fmt.Errorf("failed to initialize wallet: %v", err)
+			return fmt.Errorf("failed to execute create user request: %w", err)
 		}
-	}
 
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+		// Creating default pocket with its wallets
+		if _, err := s.createPocket(ctx, tx, userID, DefaultPocketName, true); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, AuditRecord{
+			Action:  AuditRegister,
+			UserID:  &userID,
+			Details: map[string]any{"username": username, "email": email},
+		})
+	})
+	if err != nil {
+		return 0, err
 	}
-
 	return userID, nil
 }
 
 func (s *StorageConn) GetUserData(ctx context.Context, username string) (*User, error) {
 	var user User
-	query := `select id, username, email, password from users where username = $1`
-	err := s.DB.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	query := `select id, username, email, password, frozen from users where username = $1`
+	err := s.DB.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Frozen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperr.ErrUserNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request %v", err)
+		return nil, fmt.Errorf("failed to execute request %w", err)
 	}
 	return &user, nil
 }
 
-func (s *StorageConn) GetBalance(ctx context.Context, userID int) (map[string]float64, error) {
-	query := `select currency, amount from wallet 
-	where user_id = $1`
+// GetBalance return total, available and held amount per currency of the pocket,
+// pocket 0 is the default pocket
+func (s *StorageConn) GetBalance(ctx context.Context, userID int, pocketID int64) (map[string]Balance, error) {
+	pocket, err := resolvePocket(ctx, s.DB, userID, pocketID)
+	if err != nil {
+		return nil, err
+	}
+	query := `select currency, amount, amount - held, held from wallet
+	where pocket_id = $1`
 
-	rows, err := s.DB.QueryContext(ctx, query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, pocket)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request %v", err)
+		return nil, fmt.Errorf("failed to execute request %w", err)
 	}
-	balance := make(map[string]float64)
+	defer rows.Close()
+
+	balance := make(map[string]Balance)
 	for rows.Next() {
 		var currency string
-		var amount float64
-		err = rows.Scan(&currency, &amount)
+		var b Balance
+		err = rows.Scan(&currency, &b.Total, &b.Available, &b.Held)
 		if err != nil {
 			return nil, err
 		}
-		balance[currency] = amount
+		balance[currency] = b
 	}
-	return balance, nil
+	return balance, rows.Err()
 }
 
-func (s *StorageConn) BalanceReplenishment(ctx context.Context, userID int, currency string, amount float64) error {
-	query := `update wallet
-	set amount = amount + $1
-	where user_id = $2 and currency = $3;`
+func (s *StorageConn) BalanceReplenishment(ctx context.Context, userID int, pocketID int64, currency string, amount float64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+		if err != nil {
+			return err
+		}
+		if _, err := lockWallets(ctx, tx, pocket, currency); err != nil {
+			return err
+		}
 
-	_, err := s.DB.ExecContext(ctx, query, amount, userID, currency)
-	if err != nil {
-		return fmt.Errorf("insert failed: %v", err)
-	}
-	return nil
+		balance, err := addToWallet(ctx, tx, pocket, currency, amount)
+		if err != nil {
+			return err
+		}
+		t := &Transaction{UserID: userID, PocketID: pocket, Currency: currency, Kind: TxDeposit, Amount: amount, BalanceAfter: balance}
+		if err := recordTx(ctx, tx, t); err != nil {
+			return err
+		}
+		if err := enqueueEvent(ctx, tx, userID, EventDeposit, t); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, AuditRecord{
+			Action:  AuditDeposit,
+			UserID:  &userID,
+			Before:  map[string]float64{currency: balance - amount},
+			After:   map[string]float64{currency: balance},
+			Details: map[string]any{"pocket_id": pocket, "currency": currency, "amount": amount, "transaction_id": t.ID},
+		})
+	})
 }
 
-func (s *StorageConn) BalanceWithdraw(ctx context.Context, userID int, currency string, amount float64) error {
-	query := `update wallet
-	set amount = amount - $1
-	where user_id = $2 and currency = $3;`
+func (s *StorageConn) BalanceWithdraw(ctx context.Context, userID int, pocketID int64, currency string, amount float64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+		if err != nil {
+			return err
+		}
+		balances, err := lockWallets(ctx, tx, pocket, currency)
+		if err != nil {
+			return err
+		}
+		if balances[currency] < amount {
+			return apperr.ErrInsufficientFunds
+		}
+
+		balance, err := addToWallet(ctx, tx, pocket, currency, -amount)
+		if err != nil {
+			return err
+		}
+		t := &Transaction{UserID: userID, PocketID: pocket, Currency: currency, Kind: TxWithdrawal, Amount: -amount, BalanceAfter: balance}
+		if err := recordTx(ctx, tx, t); err != nil {
+			return err
+		}
+		if err := enqueueEvent(ctx, tx, userID, EventWithdrawal, t); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, AuditRecord{
+			Action:  AuditWithdrawal,
+			UserID:  &userID,
+			Before:  map[string]float64{currency: balance + amount},
+			After:   map[string]float64{currency: balance},
+			Details: map[string]any{"pocket_id": pocket, "currency": currency, "amount": amount, "transaction_id": t.ID},
+		})
+	})
+}
 
-	result, err := s.DB.ExecContext(ctx, query, amount, userID, currency)
-	if err != nil {
-		return fmt.Errorf("insert failed: %v", err)
+// Exchange move amount of fromCurrency into toCurrency of the same pocket at the given rate
+// in one transaction. Return credited amount.
+func (s *StorageConn) Exchange(ctx context.Context, userID int, pocketID int64, fromCurrency, toCurrency string, amount, rate float64) (float64, error) {
+	if fromCurrency == toCurrency {
+		return 0, apperr.Invalid("can not exchange %s to itself", fromCurrency)
 	}
-	n, _ := result.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("insufficient funds on balance: %v", err)
+	toAmount := amount * rate
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+		if err != nil {
+			return err
+		}
+		balances, err := lockWallets(ctx, tx, pocket, fromCurrency, toCurrency)
+		if err != nil {
+			return err
+		}
+		if balances[fromCurrency] < amount {
+			return apperr.ErrInsufficientFunds
+		}
+
+		fromBalance, err := addToWallet(ctx, tx, pocket, fromCurrency, -amount)
+		if err != nil {
+			return err
+		}
+		out := &Transaction{UserID: userID, PocketID: pocket, Currency: fromCurrency, Kind: TxExchange, Amount: -amount, BalanceAfter: fromBalance, Rate: &rate}
+		if err := recordTx(ctx, tx, out); err != nil {
+			return err
+		}
+
+		toBalance, err := addToWallet(ctx, tx, pocket, toCurrency, toAmount)
+		if err != nil {
+			return err
+		}
+		in := &Transaction{UserID: userID, PocketID: pocket, Currency: toCurrency, Kind: TxExchange, Amount: toAmount, BalanceAfter: toBalance, Rate: &rate, RelatedID: &out.ID}
+		if err := recordTx(ctx, tx, in); err != nil {
+			return err
+		}
+		if err := enqueueEvent(ctx, tx, userID, EventExchange, ExchangeEvent{From: *out, To: *in, Rate: rate}); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, AuditRecord{
+			Action: AuditExchange,
+			UserID: &userID,
+			Before: map[string]float64{fromCurrency: fromBalance + amount, toCurrency: toBalance - toAmount},
+			After:  map[string]float64{fromCurrency: fromBalance, toCurrency: toBalance},
+			Details: map[string]any{
+				"pocket_id": pocket, "from_currency": fromCurrency, "to_currency": toCurrency,
+				"amount": amount, "credited": toAmount, "rate": rate, "transaction_ids": []int64{out.ID, in.ID},
+			},
+		})
+	})
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return toAmount, nil
 }
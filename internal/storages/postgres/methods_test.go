@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// TestConcurrentWithdrawAndExchange race withdrawals and exchanges of one user and check that
+// every successful movement is in the balances, none went negative and the ledger matches them
+func TestConcurrentWithdrawAndExchange(t *testing.T) {
+	s := testStorage(t)
+	const (
+		seed    = 100.0
+		workers = 16
+		ops     = 50
+	)
+	userID := testUser(t, s, seed)
+	ctx := context.Background()
+
+	// Amounts are whole cents and rates 1 or 2, so the expected balances are exact
+	var mu sync.Mutex
+	expected := make(map[string]int64)
+	for _, currency := range s.Currencies {
+		expected[currency] = seed * 100
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				from := s.Currencies[rand.IntN(len(s.Currencies))]
+				cents := 1 + rand.Int64N(seed*100/4)
+				amount := float64(cents) / 100
+
+				var err error
+				if rand.IntN(2) == 0 {
+					if err = s.BalanceWithdraw(ctx, userID, 0, from, amount); err == nil {
+						mu.Lock()
+						expected[from] -= cents
+						mu.Unlock()
+					}
+				} else {
+					to := s.Currencies[(slices.Index(s.Currencies, from)+1+rand.IntN(len(s.Currencies)-1))%len(s.Currencies)]
+					rate := float64(1 + rand.IntN(2))
+					if _, err = s.Exchange(ctx, userID, 0, from, to, amount, rate); err == nil {
+						mu.Lock()
+						expected[from] -= cents
+						expected[to] += cents * int64(rate)
+						mu.Unlock()
+					}
+				}
+				if err != nil && !errors.Is(err, apperr.ErrInsufficientFunds) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	wallets, ledger := ledgerTotals(t, s, userID)
+	for _, currency := range s.Currencies {
+		got := math.Round(wallets[currency] * 100)
+		if got < 0 {
+			t.Errorf("%s balance went negative: %v", currency, wallets[currency])
+		}
+		if int64(got) != expected[currency] {
+			t.Errorf("%s balance = %v, want %v", currency, wallets[currency], float64(expected[currency])/100)
+		}
+		if math.Round(ledger[currency]*100) != got {
+			t.Errorf("%s ledger sums to %v, wallets hold %v", currency, ledger[currency], wallets[currency])
+		}
+	}
+}
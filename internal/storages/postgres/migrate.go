@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationsTable = `create table if not exists schema_migrations (
+	version    text primary key,
+	applied_at timestamptz not null default now()
+);`
+
+// migrateLockKey keeps one migrator at a time across all instances
+const migrateLockKey = 0x6d69677261746573 // "migrates"
+
+type migration struct {
+	version string
+	sql     string
+}
+
+func loadMigrations() ([]migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		data, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		migrations = append(migrations, migration{version: version, sql: string(data)})
+	}
+	return migrations, nil
+}
+
+func appliedMigrations(ctx context.Context, db queryer) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `select version from schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Migrate apply pending migrations, each one in its own transaction.
+// Instances starting together wait on a session advisory lock held from reading the
+// applied versions to the last migration, so every migration runs exactly once.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	// The session lock belongs to a connection, so everything runs on this one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrateLockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrateLockKey); err != nil {
+			slog.Warn("failed to unlock migrations", "error", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, migrationsTable); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return err
+		}
+		slog.Info("applied migration", "version", m.version)
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.Conn, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start migration %s: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return fmt.Errorf("migration %s failed: %w", m.version, err)
+	}
+	if _, err := tx.ExecContext(ctx, `insert into schema_migrations (version) values ($1)`, m.version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m.version, err)
+	}
+	return tx.Commit()
+}
+
+// PendingMigrations return versions embedded in the binary but not applied to the database
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m.version)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,14 @@
+-- Baseline schema. IF NOT EXISTS keeps it safe on databases created before migrations.
+CREATE TABLE IF NOT EXISTS users (
+    id       SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email    VARCHAR(255) NOT NULL UNIQUE,
+    password TEXT         NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS wallet (
+    user_id  INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    currency VARCHAR(3)     NOT NULL,
+    amount   NUMERIC(20, 2) NOT NULL DEFAULT 0,
+    UNIQUE (user_id, currency)
+);
@@ -0,0 +1,25 @@
+-- Frozen accounts can log in and read their balance but can not move money.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS frozen BOOLEAN NOT NULL DEFAULT false;
+
+-- Append-only ledger, every change of wallet.amount writes one row.
+-- amount is signed: credits are positive, debits negative.
+CREATE TABLE IF NOT EXISTS transactions (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    currency      VARCHAR(3)     NOT NULL,
+    kind          VARCHAR(32)    NOT NULL,
+    amount        NUMERIC(20, 2) NOT NULL,
+    balance_after NUMERIC(20, 2) NOT NULL,
+    rate          DOUBLE PRECISION,
+    related_id    BIGINT REFERENCES transactions (id),
+    reason        TEXT,
+    created_at    TIMESTAMPTZ    NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transactions_user_created_idx ON transactions (user_id, created_at DESC);
+
+-- Opening entries, so reconciliation explains balances that existed before the ledger.
+INSERT INTO transactions (user_id, currency, kind, amount, balance_after, reason)
+SELECT user_id, currency, 'opening', amount, amount, 'balance before ledger'
+FROM wallet
+WHERE amount <> 0;
@@ -0,0 +1,4 @@
+-- Last line of defence against negative balances. NOT VALID skips rows written
+-- before withdrawals were guarded, new and updated rows are checked.
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_amount_non_negative;
+ALTER TABLE wallet ADD CONSTRAINT wallet_amount_non_negative CHECK (amount >= 0) NOT VALID;
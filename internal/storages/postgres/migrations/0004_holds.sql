@@ -0,0 +1,24 @@
+-- Funds reserved by holds stay in amount until captured, available is amount - held.
+ALTER TABLE wallet ADD COLUMN IF NOT EXISTS held NUMERIC(20, 2) NOT NULL DEFAULT 0;
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_held_within_amount;
+ALTER TABLE wallet ADD CONSTRAINT wallet_held_within_amount CHECK (held >= 0 AND held <= amount) NOT VALID;
+
+CREATE TABLE IF NOT EXISTS holds (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    currency    VARCHAR(3)     NOT NULL,
+    amount      NUMERIC(20, 2) NOT NULL CHECK (amount > 0),
+    captured    NUMERIC(20, 2) NOT NULL DEFAULT 0,
+    -- active, captured, released or expired
+    status      VARCHAR(16)    NOT NULL DEFAULT 'active',
+    description TEXT,
+    expires_at  TIMESTAMPTZ    NOT NULL,
+    created_at  TIMESTAMPTZ    NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ    NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS holds_user_created_idx ON holds (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS holds_active_expires_idx ON holds (expires_at) WHERE status = 'active';
+
+-- Captures point at the hold they settle
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS hold_id BIGINT REFERENCES holds (id);
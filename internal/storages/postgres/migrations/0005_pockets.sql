@@ -0,0 +1,39 @@
+-- Named pockets split the funds of a user, every pocket has its own wallet per currency.
+-- The default pocket keeps the balances that existed before pockets.
+CREATE TABLE IF NOT EXISTS pockets (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       VARCHAR(64) NOT NULL,
+    is_default BOOLEAN     NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS pockets_user_name_idx ON pockets (user_id, lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS pockets_user_default_idx ON pockets (user_id) WHERE is_default;
+
+INSERT INTO pockets (user_id, name, is_default)
+SELECT u.id, 'Main', true
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM pockets p WHERE p.user_id = u.id AND p.is_default);
+
+ALTER TABLE wallet ADD COLUMN IF NOT EXISTS pocket_id BIGINT REFERENCES pockets (id) ON DELETE CASCADE;
+UPDATE wallet w SET pocket_id = p.id
+FROM pockets p
+WHERE p.user_id = w.user_id AND p.is_default AND w.pocket_id IS NULL;
+ALTER TABLE wallet ALTER COLUMN pocket_id SET NOT NULL;
+
+-- A wallet is now one currency of one pocket
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_user_id_currency_key;
+CREATE UNIQUE INDEX IF NOT EXISTS wallet_pocket_currency_idx ON wallet (pocket_id, currency);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS pocket_id BIGINT REFERENCES pockets (id);
+UPDATE transactions t SET pocket_id = p.id
+FROM pockets p
+WHERE p.user_id = t.user_id AND p.is_default AND t.pocket_id IS NULL;
+ALTER TABLE transactions ALTER COLUMN pocket_id SET NOT NULL;
+
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS pocket_id BIGINT REFERENCES pockets (id);
+UPDATE holds h SET pocket_id = p.id
+FROM pockets p
+WHERE p.user_id = h.user_id AND p.is_default AND h.pocket_id IS NULL;
+ALTER TABLE holds ALTER COLUMN pocket_id SET NOT NULL;
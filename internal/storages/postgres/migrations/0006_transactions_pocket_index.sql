@@ -0,0 +1,2 @@
+-- Statements read one pocket wallet over a period
+CREATE INDEX IF NOT EXISTS transactions_pocket_currency_created_idx ON transactions (pocket_id, currency, created_at);
@@ -0,0 +1,38 @@
+-- Append-only audit trail. Every entry stores the hash of the previous one, so editing,
+-- inserting or deleting a row in the middle breaks the chain (walletctl audit verify).
+-- JSON documents are kept as text, the hash covers exactly the stored bytes.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ NOT NULL,
+    action          VARCHAR(64) NOT NULL,
+    -- who did it, NULL for anonymous requests and the operator CLI
+    actor_id        INTEGER,
+    -- whose account is affected
+    user_id         INTEGER,
+    ip              TEXT        NOT NULL DEFAULT '',
+    user_agent      TEXT        NOT NULL DEFAULT '',
+    request_id      TEXT        NOT NULL DEFAULT '',
+    balances_before TEXT,
+    balances_after  TEXT,
+    details         TEXT        NOT NULL DEFAULT '{}',
+    prev_hash       CHAR(64)    NOT NULL,
+    hash            CHAR(64)    NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_user_idx ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
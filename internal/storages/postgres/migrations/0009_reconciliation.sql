@@ -0,0 +1,40 @@
+-- Reports of the reconciliation job. A run checks every wallet against the sum of its
+-- ledger entries and every currency as a whole, all from one snapshot.
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id              BIGSERIAL PRIMARY KEY,
+    started_at      TIMESTAMPTZ NOT NULL,
+    finished_at     TIMESTAMPTZ NOT NULL,
+    -- scheduled, admin or cli
+    trigger         VARCHAR(16) NOT NULL,
+    -- ok or mismatch
+    status          VARCHAR(16) NOT NULL,
+    wallets_checked INTEGER     NOT NULL,
+    discrepancies   INTEGER     NOT NULL
+);
+
+-- Per currency totals of a run: credits and debits of the whole ledger, what the wallets hold,
+-- and the net of internal transfers, which must be zero
+CREATE TABLE IF NOT EXISTS reconciliation_totals (
+    run_id       BIGINT         NOT NULL REFERENCES reconciliation_runs (id) ON DELETE CASCADE,
+    currency     VARCHAR(3)     NOT NULL,
+    credits      NUMERIC(20, 2) NOT NULL,
+    debits       NUMERIC(20, 2) NOT NULL,
+    wallet_total NUMERIC(20, 2) NOT NULL,
+    transfer_net NUMERIC(20, 2) NOT NULL,
+    PRIMARY KEY (run_id, currency)
+);
+
+CREATE TABLE IF NOT EXISTS reconciliation_discrepancies (
+    id         BIGSERIAL PRIMARY KEY,
+    run_id     BIGINT         NOT NULL REFERENCES reconciliation_runs (id) ON DELETE CASCADE,
+    -- wallet: balance differs from its ledger, currency: wallets differ from credits minus debits,
+    -- transfer: transfer legs of the currency do not net to zero
+    kind       VARCHAR(16)    NOT NULL,
+    user_id    INTEGER,
+    pocket_id  BIGINT,
+    currency   VARCHAR(3)     NOT NULL,
+    balance    NUMERIC(20, 2) NOT NULL,
+    ledger_sum NUMERIC(20, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS reconciliation_discrepancies_run_idx ON reconciliation_discrepancies (run_id);
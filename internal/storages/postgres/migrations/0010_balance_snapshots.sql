@@ -0,0 +1,19 @@
+-- Daily balances at UTC midnights. A snapshot holds every wallet balance built from ledger
+-- entries created strictly before taken_at, wallets with a zero balance are left out, so a
+-- historical balance is the latest snapshot plus the entries between it and the asked moment.
+CREATE TABLE IF NOT EXISTS balance_snapshot_runs (
+    taken_at   TIMESTAMPTZ PRIMARY KEY,
+    wallets    INTEGER     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    taken_at  TIMESTAMPTZ    NOT NULL REFERENCES balance_snapshot_runs (taken_at) ON DELETE CASCADE,
+    pocket_id BIGINT         NOT NULL,
+    currency  VARCHAR(3)     NOT NULL,
+    amount    NUMERIC(20, 2) NOT NULL,
+    PRIMARY KEY (taken_at, pocket_id, currency)
+);
+
+-- Snapshots and system wide reports read the ledger by time only
+CREATE INDEX IF NOT EXISTS transactions_created_idx ON transactions (created_at);
@@ -0,0 +1,9 @@
+-- Rates as they were quoted, so balances can be valued at a past moment.
+-- A cached quote is recorded once however often the recorder sees it.
+CREATE TABLE IF NOT EXISTS rate_history (
+    from_currency VARCHAR(3)       NOT NULL,
+    to_currency   VARCHAR(3)       NOT NULL,
+    fetched_at    TIMESTAMPTZ      NOT NULL,
+    rate          DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (to_currency, from_currency, fetched_at)
+);
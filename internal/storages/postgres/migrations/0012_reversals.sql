@@ -0,0 +1,9 @@
+-- A reversal posts compensating entries of kind 'reversal', each pointing at the entry it undoes.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of BIGINT REFERENCES transactions (id);
+
+-- An entry is reversed at most once, the index also answers whether it was
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_reversal_of_idx ON transactions (reversal_of) WHERE reversal_of IS NOT NULL;
+
+-- Forced reversals may leave a wallet negative, an operator's claim on the user.
+-- Every other debit is still refused below the held amount by the wallet update itself.
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_amount_non_negative;
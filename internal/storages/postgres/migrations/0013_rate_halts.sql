@@ -0,0 +1,10 @@
+-- Pairs halted by the rate guard stay halted across restarts until an admin acknowledges them.
+CREATE TABLE IF NOT EXISTS rate_halts (
+    from_currency VARCHAR(3)       NOT NULL,
+    to_currency   VARCHAR(3)       NOT NULL,
+    rejected_rate DOUBLE PRECISION NOT NULL,
+    last_rate     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    reason        TEXT             NOT NULL,
+    halted_at     TIMESTAMPTZ      NOT NULL,
+    PRIMARY KEY (from_currency, to_currency)
+);
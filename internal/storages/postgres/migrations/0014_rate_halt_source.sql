@@ -0,0 +1,3 @@
+-- Direct quotes and cross rates of the bulk call keep separate guard baselines,
+-- an acknowledged halt updates the baseline of the source that was rejected.
+ALTER TABLE rate_halts ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'quote';
@@ -0,0 +1,6 @@
+-- The audit log is split into independent hash chains: logins, admin requests,
+-- one per user and one for the rest. Appends lock only their own chain.
+-- Existing entries stay on the 'main' chain, their hashes do not cover the chain name.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS chain TEXT NOT NULL DEFAULT 'main';
+ALTER TABLE audit_log ALTER COLUMN chain DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS audit_log_chain_idx ON audit_log (chain, id);
@@ -0,0 +1,12 @@
+-- Only forced reversals may leave a wallet below zero or below its held funds, they mark it
+-- overdrawn and the checks let exactly those wallets through. Credits clear the mark once the
+-- balance covers the held funds again, every other write keeps the non-negative guarantee.
+ALTER TABLE wallet ADD COLUMN IF NOT EXISTS overdrawn BOOLEAN NOT NULL DEFAULT false;
+
+-- Wallets left negative by forced reversals before the mark existed
+UPDATE wallet SET overdrawn = true WHERE amount < held OR amount < 0;
+
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_amount_non_negative;
+ALTER TABLE wallet ADD CONSTRAINT wallet_amount_non_negative CHECK (amount >= 0 OR overdrawn) NOT VALID;
+ALTER TABLE wallet DROP CONSTRAINT IF EXISTS wallet_held_within_amount;
+ALTER TABLE wallet ADD CONSTRAINT wallet_held_within_amount CHECK (held >= 0 AND (held <= amount OR overdrawn)) NOT VALID;
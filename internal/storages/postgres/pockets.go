@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// DefaultPocketName is the name of the pocket every user starts with
+const DefaultPocketName = "Main"
+
+// Pocket is a named part of the user's funds with its own wallet per currency
+type Pocket struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Default   bool               `json:"default"`
+	CreatedAt time.Time          `json:"created_at"`
+	Balances  map[string]Balance `json:"balances"`
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// resolvePocket check the pocket belongs to the user and return its id, pocketID 0 is the default pocket
+func resolvePocket(ctx context.Context, q rowQuerier, userID int, pocketID int64) (int64, error) {
+	query := `select id from pockets
+	where user_id = $1 and (($2 = 0 and is_default) or id = $2)`
+
+	var id int64
+	err := q.QueryRowContext(ctx, query, userID, pocketID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		if pocketID == 0 {
+			return 0, apperr.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%w: %d", apperr.ErrPocketNotFound, pocketID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find pocket: %w", err)
+	}
+	return id, nil
+}
+
+// createPocket insert the pocket with an empty wallet for every enabled currency
+func (s *StorageConn) createPocket(ctx context.Context, tx *sql.Tx, userID int, name string, isDefault bool) (*Pocket, error) {
+	pocket := Pocket{Name: name, Default: isDefault, Balances: make(map[string]Balance, len(s.Currencies))}
+	query := `insert into pockets (user_id, name, is_default)
+	values ($1, $2, $3)
+	returning id, created_at;`
+	err := tx.QueryRowContext(ctx, query, userID, name, isDefault).Scan(&pocket.ID, &pocket.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %s", apperr.ErrDuplicatePocket, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pocket: %w", err)
+	}
+
+	for _, currency := range s.Currencies {
+		query = `
+			INSERT INTO wallet (user_id, pocket_id, currency, amount)
+			VALUES ($1, $2, $3, 0);
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, pocket.ID, currency); err != nil {
+			return nil, fmt.Errorf("failed to initialize wallet: %w", err)
+		}
+		pocket.Balances[currency] = Balance{}
+	}
+	return &pocket, nil
+}
+
+// CreatePocket add a named pocket to the user
+func (s *StorageConn) CreatePocket(ctx context.Context, userID int, name string) (*Pocket, error) {
+	var pocket *Pocket
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		pocket, err = s.createPocket(ctx, tx, userID, name, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pocket, nil
+}
+
+// Pockets return pockets of the user with their balances, the default pocket first
+func (s *StorageConn) Pockets(ctx context.Context, userID int) ([]Pocket, error) {
+	query := `select p.id, p.name, p.is_default, p.created_at, w.currency, w.amount, w.amount - w.held, w.held
+	from pockets p
+	left join wallet w on w.pocket_id = p.id
+	where p.user_id = $1
+	order by p.is_default desc, p.id, w.currency`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pockets: %w", err)
+	}
+	defer rows.Close()
+
+	pockets := []Pocket{}
+	for rows.Next() {
+		var (
+			p        Pocket
+			currency sql.NullString
+			total    sql.NullFloat64
+			avail    sql.NullFloat64
+			held     sql.NullFloat64
+		)
+		if err := rows.Scan(&p.ID, &p.Name, &p.Default, &p.CreatedAt, &currency, &total, &avail, &held); err != nil {
+			return nil, err
+		}
+		if n := len(pockets); n == 0 || pockets[n-1].ID != p.ID {
+			p.Balances = make(map[string]Balance)
+			pockets = append(pockets, p)
+		}
+		if currency.Valid {
+			pockets[len(pockets)-1].Balances[currency.String] = Balance{Total: total.Float64, Available: avail.Float64, Held: held.Float64}
+		}
+	}
+	return pockets, rows.Err()
+}
+
+// Transfer move amount of one currency between two pockets of the user, free of charge.
+// Pocket 0 is the default pocket. Return the debit and the credit ledger entries.
+func (s *StorageConn) Transfer(ctx context.Context, userID int, fromPocket, toPocket int64, currency string, amount float64) ([]Transaction, error) {
+	var txs []Transaction
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkNotFrozen(ctx, tx, userID); err != nil {
+			return err
+		}
+		from, err := resolvePocket(ctx, tx, userID, fromPocket)
+		if err != nil {
+			return err
+		}
+		to, err := resolvePocket(ctx, tx, userID, toPocket)
+		if err != nil {
+			return err
+		}
+		if from == to {
+			return apperr.Invalid("can not transfer to the same pocket")
+		}
+
+		// Lock both wallets in pocket order like every other multi-wallet transaction
+		var available float64
+		for _, id := range []int64{min(from, to), max(from, to)} {
+			balances, err := lockWallets(ctx, tx, id, currency)
+			if err != nil {
+				return err
+			}
+			if id == from {
+				available = balances[currency]
+			}
+		}
+		if available < amount {
+			return apperr.ErrInsufficientFunds
+		}
+
+		fromBalance, err := addToWallet(ctx, tx, from, currency, -amount)
+		if err != nil {
+			return err
+		}
+		out := Transaction{UserID: userID, PocketID: from, Currency: currency, Kind: TxTransfer, Amount: -amount, BalanceAfter: fromBalance}
+		if err := recordTx(ctx, tx, &out); err != nil {
+			return err
+		}
+
+		toBalance, err := addToWallet(ctx, tx, to, currency, amount)
+		if err != nil {
+			return err
+		}
+		in := Transaction{UserID: userID, PocketID: to, Currency: currency, Kind: TxTransfer, Amount: amount, BalanceAfter: toBalance, RelatedID: &out.ID}
+		if err := recordTx(ctx, tx, &in); err != nil {
+			return err
+		}
+		txs = []Transaction{out, in}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
@@ -0,0 +1,347 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/metrics"
+)
+
+// Reconciliation triggers and statuses
+const (
+	ReconcileScheduled = "scheduled"
+	ReconcileAdmin     = "admin"
+	ReconcileCLI       = "cli"
+
+	ReconcileOK       = "ok"
+	ReconcileMismatch = "mismatch"
+)
+
+// Discrepancy kinds
+const (
+	// Wallet balance differs from the sum of its ledger entries
+	DiscrepancyWallet = "wallet"
+	// Wallets of the currency together differ from credits minus debits of the ledger
+	DiscrepancyCurrency = "currency"
+	// Transfer legs of the currency do not net to zero
+	DiscrepancyTransfer = "transfer"
+)
+
+// reconcileLockKey keeps one run at a time across all instances
+const reconcileLockKey = 0x7265636f6e63696c // "reconcil"
+
+// Discrepancy is a balance which does not match the ledger. User and pocket are set for wallet discrepancies only.
+type Discrepancy struct {
+	Kind       string  `json:"kind"`
+	UserID     int     `json:"user_id,omitempty"`
+	PocketID   int64   `json:"pocket_id,omitempty"`
+	Currency   string  `json:"currency"`
+	Balance    float64 `json:"balance"`
+	LedgerSum  float64 `json:"ledger_sum"`
+	Difference float64 `json:"difference"`
+}
+
+// CurrencyTotals is the system wide view of one currency. Credits and Debits are positive sums of the ledger.
+type CurrencyTotals struct {
+	Currency    string  `json:"currency"`
+	Credits     float64 `json:"credits"`
+	Debits      float64 `json:"debits"`
+	WalletTotal float64 `json:"wallet_total"`
+	TransferNet float64 `json:"transfer_net"`
+}
+
+// ReconciliationRun is the report of one reconciliation
+type ReconciliationRun struct {
+	ID               int64            `json:"id"`
+	StartedAt        time.Time        `json:"started_at"`
+	FinishedAt       time.Time        `json:"finished_at"`
+	Trigger          string           `json:"trigger"`
+	Status           string           `json:"status"`
+	WalletsChecked   int              `json:"wallets_checked"`
+	DiscrepancyCount int              `json:"discrepancy_count"`
+	Totals           []CurrencyTotals `json:"totals,omitempty"`
+	Discrepancies    []Discrepancy    `json:"discrepancies,omitempty"`
+}
+
+// RunReconciliation recompute every wallet balance from the ledger, check that per currency the
+// wallets hold exactly credits minus debits and that transfers net to zero, and store the report.
+// Everything is read from one snapshot, so money moving during the run can not cause false alarms.
+func (s *StorageConn) RunReconciliation(ctx context.Context, trigger string) (*ReconciliationRun, error) {
+	run := &ReconciliationRun{Trigger: trigger, Totals: []CurrencyTotals{}, Discrepancies: []Discrepancy{}}
+	err := s.runReconciliation(ctx, run)
+	if errors.Is(err, apperr.ErrReconcileRunning) {
+		return nil, err
+	}
+	if err != nil {
+		metrics.Reconciliation("failed", 0)
+		return nil, err
+	}
+
+	metrics.Reconciliation(run.Status, run.DiscrepancyCount)
+	if run.Status == ReconcileMismatch {
+		slog.ErrorContext(ctx, "reconciliation found discrepancies", "run_id", run.ID, "discrepancies", run.DiscrepancyCount)
+	}
+	return run, nil
+}
+
+func (s *StorageConn) runReconciliation(ctx context.Context, run *ReconciliationRun) error {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `select pg_try_advisory_xact_lock($1), now()`, reconcileLockKey).Scan(&locked, &run.StartedAt); err != nil {
+		return fmt.Errorf("failed to lock reconciliation: %w", err)
+	}
+	if !locked {
+		return apperr.ErrReconcileRunning
+	}
+
+	if err := tx.QueryRowContext(ctx, `select count(*) from wallet`).Scan(&run.WalletsChecked); err != nil {
+		return fmt.Errorf("failed to count wallets: %w", err)
+	}
+	if err := walletDiscrepancies(ctx, tx, run); err != nil {
+		return err
+	}
+	if err := currencyTotals(ctx, tx, run); err != nil {
+		return err
+	}
+
+	run.DiscrepancyCount = len(run.Discrepancies)
+	run.Status = ReconcileOK
+	if run.DiscrepancyCount > 0 {
+		run.Status = ReconcileMismatch
+	}
+	if err := saveRun(ctx, tx, run); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reconciliation: %w", err)
+	}
+	return nil
+}
+
+// walletDiscrepancies compare every wallet balance with the sum of its ledger entries
+func walletDiscrepancies(ctx context.Context, tx *sql.Tx, run *ReconciliationRun) error {
+	query := `select w.user_id, w.pocket_id, w.currency, w.amount, coalesce(sum(t.amount), 0)
+	from wallet w
+	left join transactions t on t.pocket_id = w.pocket_id and t.currency = w.currency
+	group by w.user_id, w.pocket_id, w.currency, w.amount
+	having w.amount <> coalesce(sum(t.amount), 0)
+	order by w.user_id, w.pocket_id, w.currency`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to reconcile wallets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := Discrepancy{Kind: DiscrepancyWallet}
+		if err := rows.Scan(&d.UserID, &d.PocketID, &d.Currency, &d.Balance, &d.LedgerSum); err != nil {
+			return err
+		}
+		d.Difference = d.Balance - d.LedgerSum
+		run.Discrepancies = append(run.Discrepancies, d)
+	}
+	return rows.Err()
+}
+
+// currencyTotals sum the ledger and the wallets per currency. Comparisons are made in SQL on
+// exact numerics, floats only carry the result.
+func currencyTotals(ctx context.Context, tx *sql.Tx, run *ReconciliationRun) error {
+	query := `with ledger as (
+		select currency,
+			coalesce(sum(amount) filter (where amount > 0), 0) as credits,
+			coalesce(-sum(amount) filter (where amount < 0), 0) as debits,
+			coalesce(sum(amount) filter (where kind = 'transfer'), 0) as transfer_net
+		from transactions
+		group by currency
+	), wallets as (
+		select currency, sum(amount) as total from wallet group by currency
+	)
+	select coalesce(l.currency, w.currency),
+		coalesce(l.credits, 0), coalesce(l.debits, 0), coalesce(w.total, 0), coalesce(l.transfer_net, 0),
+		coalesce(l.credits - l.debits, 0), coalesce(l.credits - l.debits, 0) <> coalesce(w.total, 0)
+	from ledger l
+	full join wallets w on w.currency = l.currency
+	order by 1`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to sum currencies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t CurrencyTotals
+		var net float64
+		var mismatch bool
+		if err := rows.Scan(&t.Currency, &t.Credits, &t.Debits, &t.WalletTotal, &t.TransferNet, &net, &mismatch); err != nil {
+			return err
+		}
+		run.Totals = append(run.Totals, t)
+
+		if mismatch {
+			run.Discrepancies = append(run.Discrepancies, Discrepancy{
+				Kind: DiscrepancyCurrency, Currency: t.Currency, Balance: t.WalletTotal, LedgerSum: net, Difference: t.WalletTotal - net,
+			})
+		}
+		if t.TransferNet != 0 {
+			run.Discrepancies = append(run.Discrepancies, Discrepancy{
+				Kind: DiscrepancyTransfer, Currency: t.Currency, LedgerSum: t.TransferNet, Difference: -t.TransferNet,
+			})
+		}
+	}
+	return rows.Err()
+}
+
+// saveRun write the report of the run
+func saveRun(ctx context.Context, tx *sql.Tx, run *ReconciliationRun) error {
+	query := `insert into reconciliation_runs (started_at, finished_at, trigger, status, wallets_checked, discrepancies)
+	values ($1, clock_timestamp(), $2, $3, $4, $5)
+	returning id, finished_at`
+	err := tx.QueryRowContext(ctx, query, run.StartedAt, run.Trigger, run.Status, run.WalletsChecked, run.DiscrepancyCount).
+		Scan(&run.ID, &run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation run: %w", err)
+	}
+
+	for _, t := range run.Totals {
+		query := `insert into reconciliation_totals (run_id, currency, credits, debits, wallet_total, transfer_net)
+		values ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.ExecContext(ctx, query, run.ID, t.Currency, t.Credits, t.Debits, t.WalletTotal, t.TransferNet); err != nil {
+			return fmt.Errorf("failed to save reconciliation totals: %w", err)
+		}
+	}
+	for _, d := range run.Discrepancies {
+		query := `insert into reconciliation_discrepancies (run_id, kind, user_id, pocket_id, currency, balance, ledger_sum)
+		values ($1, $2, nullif($3, 0), nullif($4, 0), $5, $6, $7)`
+		if _, err := tx.ExecContext(ctx, query, run.ID, d.Kind, d.UserID, d.PocketID, d.Currency, d.Balance, d.LedgerSum); err != nil {
+			return fmt.Errorf("failed to save discrepancy: %w", err)
+		}
+	}
+	return nil
+}
+
+const runColumns = `id, started_at, finished_at, trigger, status, wallets_checked, discrepancies`
+
+func scanRun(row scanner, r *ReconciliationRun) error {
+	return row.Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Trigger, &r.Status, &r.WalletsChecked, &r.DiscrepancyCount)
+}
+
+// ReconciliationRuns return summaries of the latest runs without their details
+func (s *StorageConn) ReconciliationRuns(ctx context.Context, limit int) ([]ReconciliationRun, error) {
+	rows, err := s.DB.QueryContext(ctx, `select `+runColumns+` from reconciliation_runs order by id desc limit $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reconciliation runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ReconciliationRun{}
+	for rows.Next() {
+		var r ReconciliationRun
+		if err := scanRun(rows, &r); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// ReconciliationRun return the run with its totals and discrepancies, id 0 is the latest run
+func (s *StorageConn) ReconciliationRun(ctx context.Context, id int64) (*ReconciliationRun, error) {
+	query := `select ` + runColumns + ` from reconciliation_runs where id = $1`
+	args := []any{id}
+	if id == 0 {
+		query = `select ` + runColumns + ` from reconciliation_runs order by id desc limit 1`
+		args = nil
+	}
+
+	run := &ReconciliationRun{Totals: []CurrencyTotals{}, Discrepancies: []Discrepancy{}}
+	err := scanRun(s.DB.QueryRowContext(ctx, query, args...), run)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperr.ErrRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reconciliation run: %w", err)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `select currency, credits, debits, wallet_total, transfer_net
+	from reconciliation_totals where run_id = $1 order by currency`, run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reconciliation totals: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t CurrencyTotals
+		if err := rows.Scan(&t.Currency, &t.Credits, &t.Debits, &t.WalletTotal, &t.TransferNet); err != nil {
+			return nil, err
+		}
+		run.Totals = append(run.Totals, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.DB.QueryContext(ctx, `select kind, coalesce(user_id, 0), coalesce(pocket_id, 0), currency, balance, ledger_sum
+	from reconciliation_discrepancies where run_id = $1 order by id`, run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discrepancies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d Discrepancy
+		if err := rows.Scan(&d.Kind, &d.UserID, &d.PocketID, &d.Currency, &d.Balance, &d.LedgerSum); err != nil {
+			return nil, err
+		}
+		d.Difference = d.Balance - d.LedgerSum
+		run.Discrepancies = append(run.Discrepancies, d)
+	}
+	return run, rows.Err()
+}
+
+// PruneReconciliationRuns delete reports older than the keep latest runs
+func (s *StorageConn) PruneReconciliationRuns(ctx context.Context, keep int) error {
+	query := `delete from reconciliation_runs
+	where id < (select id from reconciliation_runs order by id desc offset $1 - 1 limit 1)`
+	if _, err := s.DB.ExecContext(ctx, query, keep); err != nil {
+		return fmt.Errorf("failed to prune reconciliation runs: %w", err)
+	}
+	return nil
+}
+
+// RunReconciler reconcile every interval until ctx is done and keep the latest keep reports
+func (s *StorageConn) RunReconciler(ctx context.Context, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := s.RunReconciliation(ctx, ReconcileScheduled)
+			if errors.Is(err, apperr.ErrReconcileRunning) {
+				// Another instance or an operator is on it
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("reconciliation failed", "error", err)
+				}
+				continue
+			}
+			if err := s.PruneReconciliationRuns(ctx, keep); err != nil && ctx.Err() == nil {
+				slog.Error("failed to prune reconciliation runs", "error", err)
+			}
+		}
+	}
+}
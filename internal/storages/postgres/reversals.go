@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// ReversalRequest is how an operator undoes a ledger entry
+type ReversalRequest struct {
+	Reason string
+	// Post the reversal even if a wallet goes negative
+	Force bool
+	// Current from->to rate for exchange reversals, nil reverses at the original rate
+	Rate *float64
+}
+
+// Reversal is the original entry with its other leg and the compensating entries, in the same order
+type Reversal struct {
+	Original []Transaction `json:"original"`
+	Entries  []Transaction `json:"entries"`
+	Forced   bool          `json:"forced"`
+}
+
+// TransactionLegs return the entry together with the other leg of its exchange or transfer, debit first
+func (s *StorageConn) TransactionLegs(ctx context.Context, id int64) ([]Transaction, error) {
+	return transactionLegs(ctx, s.DB, id, "")
+}
+
+// queryer is what reading the ledger needs from a connection or a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func transactionLegs(ctx context.Context, q queryer, id int64, lock string) ([]Transaction, error) {
+	query := `select ` + transactionColumns + `
+	from transactions
+	where id = $1 or related_id = $1 or id = (select related_id from transactions where id = $1)
+	order by amount, id ` + lock
+
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction: %w", err)
+	}
+	defer rows.Close()
+
+	var legs []Transaction
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+		legs = append(legs, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transaction: %w", err)
+	}
+	if len(legs) == 0 {
+		return nil, apperr.ErrTxNotFound
+	}
+	return legs, nil
+}
+
+// ReverseTransaction post compensating entries for the entry and the other leg of its exchange
+// or transfer. An exchange at a new rate gives back the whole credited amount and credits what it
+// buys of the debited currency now. A reversal debiting more than is available is refused unless
+// forced, forced ones may leave a wallet negative. Reversals are allowed on frozen accounts.
+func (s *StorageConn) ReverseTransaction(ctx context.Context, id int64, req ReversalRequest) (*Reversal, error) {
+	if req.Reason == "" {
+		return nil, apperr.Invalid("reversal reason is required")
+	}
+	if req.Rate != nil && *req.Rate <= 0 {
+		return nil, apperr.Invalid("reversal rate must be positive")
+	}
+
+	var reversal *Reversal
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		legs, err := transactionLegs(ctx, tx, id, "for update")
+		if err != nil {
+			return err
+		}
+		kind := legs[0].Kind
+		if kind == TxOpening || kind == TxReversal {
+			return fmt.Errorf("%w: %s entries are final", apperr.ErrNotReversible, kind)
+		}
+		if req.Rate != nil && kind != TxExchange {
+			return apperr.Invalid("a rate applies to exchange reversals only")
+		}
+		for _, leg := range legs {
+			if leg.ReversedBy != nil {
+				return apperr.ErrAlreadyReversed
+			}
+		}
+
+		amounts := make([]float64, len(legs))
+		for i, leg := range legs {
+			amounts[i] = -leg.Amount
+		}
+		if req.Rate != nil && len(legs) == 2 {
+			// The debit leg is credited with what the returned amount buys now
+			amounts[0] = legs[1].Amount / *req.Rate
+		}
+
+		// Lock the wallets pocket by pocket in id order like every other multi-wallet transaction
+		pockets := make(map[int64][]string)
+		for _, leg := range legs {
+			pockets[leg.PocketID] = append(pockets[leg.PocketID], leg.Currency)
+		}
+		order := make([]int64, 0, len(pockets))
+		for pocket := range pockets {
+			order = append(order, pocket)
+		}
+		slices.Sort(order)
+		available := make(map[int64]map[string]float64, len(order))
+		for _, pocket := range order {
+			if available[pocket], err = lockWallets(ctx, tx, pocket, pockets[pocket]...); err != nil {
+				return err
+			}
+		}
+		if !req.Force {
+			for i, leg := range legs {
+				if amounts[i] < 0 && available[leg.PocketID][leg.Currency]+amounts[i] < 0 {
+					return apperr.ErrInsufficientFunds
+				}
+			}
+		}
+
+		reversal = &Reversal{Original: legs, Forced: req.Force}
+		var ids []int64
+		record := AuditRecord{
+			Action:  AuditReversal,
+			UserID:  &legs[0].UserID,
+			Before:  map[string]float64{},
+			After:   map[string]float64{},
+			Details: map[string]any{"transaction_id": id, "kind": kind, "reason": req.Reason, "forced": req.Force},
+		}
+		for i, leg := range legs {
+			var balance float64
+			if req.Force {
+				balance, err = forceAddToWallet(ctx, tx, leg.PocketID, leg.Currency, amounts[i])
+			} else {
+				balance, err = addToWallet(ctx, tx, leg.PocketID, leg.Currency, amounts[i])
+			}
+			if err != nil {
+				return err
+			}
+
+			entry := Transaction{
+				UserID: leg.UserID, PocketID: leg.PocketID, Currency: leg.Currency, Kind: TxReversal,
+				Amount: amounts[i], BalanceAfter: balance, Rate: leg.Rate, ReversalOf: &legs[i].ID, Reason: req.Reason,
+			}
+			if req.Rate != nil {
+				entry.Rate = req.Rate
+			}
+			if i > 0 {
+				first := ids[0]
+				entry.RelatedID = &first
+			}
+			if err := recordTx(ctx, tx, &entry); err != nil {
+				if isUniqueViolation(err) {
+					return apperr.ErrAlreadyReversed
+				}
+				return err
+			}
+			reversal.Entries = append(reversal.Entries, entry)
+			ids = append(ids, entry.ID)
+			reversedBy := entry.ID
+			reversal.Original[i].ReversedBy = &reversedBy
+
+			// Transfers move one currency between pockets, so their balances are told apart by pocket
+			key := leg.Currency
+			if len(pockets) > 1 {
+				key = fmt.Sprintf("%s@%d", leg.Currency, leg.PocketID)
+			}
+			record.Before[key] = balance - entry.Amount
+			record.After[key] = balance
+		}
+		record.Details["transaction_ids"] = ids
+		if req.Rate != nil {
+			record.Details["rate"] = *req.Rate
+		}
+
+		if err := enqueueEvent(ctx, tx, legs[0].UserID, EventReversal, ReversalEvent{Original: reversal.Original, Entries: reversal.Entries}); err != nil {
+			return err
+		}
+		return appendAudit(ctx, tx, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
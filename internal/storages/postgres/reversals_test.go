@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+)
+
+// TestForcedReversalOverdrawsWallet force a reversal below zero and below the held funds, then check
+// that only credits reach the overdrawn wallet and that the table still refuses unmarked negatives
+func TestForcedReversalOverdrawsWallet(t *testing.T) {
+	s := testStorage(t)
+	userID := testUser(t, s, 100)
+	ctx := context.Background()
+
+	credit, err := s.AdjustBalance(ctx, userID, 0, "USD", 50, "test credit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BalanceWithdraw(ctx, userID, 0, "USD", 120); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := s.PlaceHold(ctx, userID, 0, "USD", 20, time.Now().Add(time.Hour), "test hold")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ReverseTransaction(ctx, credit.ID, ReversalRequest{Reason: "test"}); !errors.Is(err, apperr.ErrInsufficientFunds) {
+		t.Fatalf("unforced reversal: err = %v, want ErrInsufficientFunds", err)
+	}
+	reversal, err := s.ReverseTransaction(ctx, credit.ID, ReversalRequest{Reason: "test", Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reversal.Entries[0].BalanceAfter; math.Abs(got+20) > 1e-9 || !reversal.Forced {
+		t.Fatalf("forced reversal left %v (forced %v), want -20", got, reversal.Forced)
+	}
+	if !overdrawn(t, s, userID, "USD") {
+		t.Fatal("wallet is not marked overdrawn")
+	}
+
+	if err := s.BalanceWithdraw(ctx, userID, 0, "USD", 1); !errors.Is(err, apperr.ErrInsufficientFunds) {
+		t.Fatalf("withdrawal from overdrawn wallet: err = %v, want ErrInsufficientFunds", err)
+	}
+	if _, _, err := s.CaptureHold(ctx, userID, hold.ID, 0); !errors.Is(err, apperr.ErrInsufficientFunds) {
+		t.Fatalf("capture on overdrawn wallet: err = %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := s.PlaceHold(ctx, userID, 0, "USD", 1, time.Now().Add(time.Hour), "test hold"); !errors.Is(err, apperr.ErrInsufficientFunds) {
+		t.Fatalf("hold on overdrawn wallet: err = %v, want ErrInsufficientFunds", err)
+	}
+
+	// Paying back keeps the mark until the balance covers the held funds
+	if err := s.BalanceReplenishment(ctx, userID, 0, "USD", 10); err != nil {
+		t.Fatal(err)
+	}
+	if !overdrawn(t, s, userID, "USD") {
+		t.Fatal("wallet still below zero lost the overdrawn mark")
+	}
+	if _, err := s.ReleaseHold(ctx, userID, hold.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BalanceReplenishment(ctx, userID, 0, "USD", 15); err != nil {
+		t.Fatal(err)
+	}
+	if overdrawn(t, s, userID, "USD") {
+		t.Fatal("wallet paid back is still marked overdrawn")
+	}
+	if err := s.BalanceWithdraw(ctx, userID, 0, "USD", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing but a forced reversal may write a negative balance
+	if _, err := s.DB.ExecContext(ctx, `update wallet set amount = -1 where user_id = $1 and currency = 'EUR'`, userID); err == nil {
+		t.Fatal("negative balance without the overdrawn mark was accepted")
+	}
+
+	wallets, ledger := ledgerTotals(t, s, userID)
+	if math.Abs(wallets["USD"]) > 1e-9 {
+		t.Errorf("USD balance = %v, want 0", wallets["USD"])
+	}
+	for _, currency := range s.Currencies {
+		if math.Round(ledger[currency]*100) != math.Round(wallets[currency]*100) {
+			t.Errorf("%s ledger sums to %v, wallets hold %v", currency, ledger[currency], wallets[currency])
+		}
+	}
+}
+
+func overdrawn(t *testing.T, s *StorageConn, userID int, currency string) bool {
+	t.Helper()
+
+	var marked bool
+	query := `select bool_or(overdrawn) from wallet where user_id = $1 and currency = $2`
+	if err := s.DB.QueryRowContext(context.Background(), query, userID, currency).Scan(&marked); err != nil {
+		t.Fatal(err)
+	}
+	return marked
+}
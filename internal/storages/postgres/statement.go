@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StatementSummary is the balance of one pocket wallet over a period. Credits and Debits are positive sums.
+type StatementSummary struct {
+	PocketID    int64
+	Opening     float64
+	Closing     float64
+	Credits     float64
+	Debits      float64
+	CreditCount int
+	DebitCount  int
+}
+
+// Statement read the ledger of the pocket wallet for [from, to) from one snapshot, pocket 0 is
+// the default pocket. begin receives the balances before any entry, then entry is called for every
+// movement in booking order, so long periods are streamed instead of held in memory.
+func (s *StorageConn) Statement(ctx context.Context, userID int, pocketID int64, currency string, from, to time.Time,
+	begin func(StatementSummary) error, entry func(Transaction) error) error {
+	// Repeatable read keeps the summary and the entries consistent while deposits keep coming
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	pocket, err := resolvePocket(ctx, tx, userID, pocketID)
+	if err != nil {
+		return err
+	}
+
+	// Balances are sums of the ledger rather than balance_after, so they always match the listed entries
+	sum := StatementSummary{PocketID: pocket}
+	query := `select
+		coalesce(sum(amount) filter (where created_at < $3), 0),
+		coalesce(sum(amount), 0),
+		coalesce(sum(amount) filter (where created_at >= $3 and created_at < $4 and amount > 0), 0),
+		coalesce(-sum(amount) filter (where created_at >= $3 and created_at < $4 and amount < 0), 0),
+		count(*) filter (where created_at >= $3 and created_at < $4 and amount > 0),
+		count(*) filter (where created_at >= $3 and created_at < $4 and amount < 0)
+	from transactions
+	where pocket_id = $1 and currency = $2 and created_at < $4`
+	err = tx.QueryRowContext(ctx, query, pocket, currency, from, to).
+		Scan(&sum.Opening, &sum.Closing, &sum.Credits, &sum.Debits, &sum.CreditCount, &sum.DebitCount)
+	if err != nil {
+		return fmt.Errorf("failed to summarize statement: %w", err)
+	}
+	if err := begin(sum); err != nil {
+		return err
+	}
+
+	query = `select ` + transactionColumns + `
+	from transactions
+	where pocket_id = $1 and currency = $2 and created_at >= $3 and created_at < $4 and amount <> 0
+	order by created_at, id`
+	rows, err := tx.QueryContext(ctx, query, pocket, currency, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to read statement: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			return err
+		}
+		if err := entry(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
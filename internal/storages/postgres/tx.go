@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+
+	"github.com/lib/pq"
+)
+
+// Attempts of a transaction failing with serialization or deadlock errors
+const maxTxAttempts = 5
+
+// retryableTx reports whether Postgres aborted the transaction only because of
+// a concurrent one, so running it again is safe
+func retryableTx(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	case "40001", // serialization_failure
+		"40P01": // deadlock_detected
+		return true
+	}
+	return false
+}
+
+// isUniqueViolation reports whether the insert hit a unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether the write referenced a row that does not exist
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// inTx run fn in a transaction and commit it. The whole transaction is retried
+// with jittered backoff on serialization failures and deadlocks, so fn must not
+// keep state between calls.
+func (s *StorageConn) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = s.runTx(ctx, fn)
+		if err == nil || !retryableTx(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		delay := time.Duration(rand.Int64N(int64(10*time.Millisecond)<<attempt)) + time.Millisecond
+		slog.WarnContext(ctx, "retrying transaction", "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *StorageConn) runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// lockWallets lock wallet rows of the pocket with SELECT ... FOR UPDATE and return their
+// available balances, that is the amount not reserved by holds.
+// Rows of the pocket are locked in currency order. Only one pocket is locked per call, callers
+// touching several pockets must call it pocket by pocket in id order themselves, so two
+// transactions touching the same wallets can not wait on each other in a cycle.
+func lockWallets(ctx context.Context, tx *sql.Tx, pocketID int64, currencies ...string) (map[string]float64, error) {
+	query := `select currency, amount - held from wallet
+	where pocket_id = $1 and currency = any($2)
+	order by currency
+	for update`
+
+	rows, err := tx.QueryContext(ctx, query, pocketID, pq.Array(currencies))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock wallets: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[string]float64, len(currencies))
+	for rows.Next() {
+		var currency string
+		var amount float64
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return nil, err
+		}
+		balances[currency] = amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock wallets: %w", err)
+	}
+
+	for _, currency := range currencies {
+		if _, ok := balances[currency]; !ok {
+			return nil, fmt.Errorf("%w: pocket %d, currency %s", apperr.ErrWalletNotFound, pocketID, currency)
+		}
+	}
+	return balances, nil
+}
+
+// addToWallet change the locked wallet by a signed amount and return the new balance.
+// Held funds can not be debited, credits are always taken so an overdrawn wallet can be paid back.
+func addToWallet(ctx context.Context, tx *sql.Tx, pocketID int64, currency string, amount float64) (float64, error) {
+	query := `update wallet
+	set amount = amount + $1, overdrawn = overdrawn and amount + $1 < held
+	where pocket_id = $2 and currency = $3 and ($1 >= 0 or amount + $1 >= held)
+	returning amount;`
+
+	var balance float64
+	err := tx.QueryRowContext(ctx, query, amount, pocketID, currency).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The row is locked and was checked, nothing updated means the guard failed
+		return 0, apperr.ErrInsufficientFunds
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	return balance, nil
+}
+
+// forceAddToWallet change the locked wallet by a signed amount without the held funds guard,
+// so the balance may go negative. The wallet is marked overdrawn, which is what lets it past the
+// non-negative checks of the table. Only forced reversals use it.
+func forceAddToWallet(ctx context.Context, tx *sql.Tx, pocketID int64, currency string, amount float64) (float64, error) {
+	query := `update wallet
+	set amount = amount + $1, overdrawn = amount + $1 < held
+	where pocket_id = $2 and currency = $3
+	returning amount;`
+
+	var balance float64
+	err := tx.QueryRowContext(ctx, query, amount, pocketID, currency).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: pocket %d, currency %s", apperr.ErrWalletNotFound, pocketID, currency)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	return balance, nil
+}
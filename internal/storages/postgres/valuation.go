@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+	"gw-currncy-wallet/internal/storages"
+
+	"github.com/lib/pq"
+)
+
+// HistoryPoint is the net worth of a user at one moment, before conversion
+type HistoryPoint struct {
+	At time.Time
+	// Total per currency over all pockets
+	Balances map[string]float64
+	// Latest rate into the valuation currency recorded before At, keyed by source currency
+	Rates map[string]storages.Rate
+}
+
+// RecordRates store quotes in the rate history, quotes recorded before are skipped.
+// Return how many were new.
+func (s *StorageConn) RecordRates(ctx context.Context, rates []storages.Rate) (int, error) {
+	recorded := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		recorded = 0
+		for _, r := range rates {
+			result, err := tx.ExecContext(ctx, `insert into rate_history (from_currency, to_currency, fetched_at, rate)
+				values ($1, $2, $3, $4) on conflict do nothing`, r.FromCurrency, r.ToCurrency, r.FetchedAt.UTC(), r.Rate)
+			if err != nil {
+				return fmt.Errorf("failed to record rate: %w", err)
+			}
+			n, _ := result.RowsAffected()
+			recorded += int(n)
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// RatesAt return the latest rate of every currency into to recorded up to at, keyed by source currency
+func (s *StorageConn) RatesAt(ctx context.Context, to string, at time.Time) (map[string]storages.Rate, error) {
+	query := `select distinct on (from_currency) from_currency, rate, fetched_at
+		from rate_history
+		where to_currency = $1 and fetched_at < $2
+		order by from_currency, fetched_at desc`
+
+	rows, err := s.DB.QueryContext(ctx, query, to, asOfBound(at))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate history: %w", err)
+	}
+	defer rows.Close()
+
+	rates := make(map[string]storages.Rate)
+	for rows.Next() {
+		r := storages.Rate{ToCurrency: to}
+		if err := rows.Scan(&r.FromCurrency, &r.Rate, &r.FetchedAt); err != nil {
+			return nil, err
+		}
+		r.FetchedAt = r.FetchedAt.UTC()
+		rates[r.FromCurrency] = r
+	}
+	return rates, rows.Err()
+}
+
+// NetWorthHistory return the user's balances over all pockets and the rates into currency as they
+// were at each of the moments. Balances come from the daily snapshots plus the ledger after them.
+func (s *StorageConn) NetWorthHistory(ctx context.Context, userID int, currency string, moments []time.Time) ([]HistoryPoint, error) {
+	var exists bool
+	if err := s.DB.QueryRowContext(ctx, `select exists(select 1 from users where id = $1)`, userID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if !exists {
+		return nil, apperr.ErrUserNotFound
+	}
+
+	// Points are matched by position, the moments go to Postgres as their exclusive bounds
+	history := make([]HistoryPoint, len(moments))
+	bounds := make([]string, len(moments))
+	for i, at := range moments {
+		history[i] = HistoryPoint{At: at.UTC(), Balances: map[string]float64{}, Rates: map[string]storages.Rate{}}
+		bounds[i] = asOfBound(at).UTC().Format(time.RFC3339Nano)
+	}
+	points := `points as (
+		select p.n, p.bound from unnest($2::timestamptz[]) with ordinality as p (bound, n)
+	)`
+
+	balances := `with ` + points + `, owned as (
+		select id from pockets where user_id = $1
+	), snaps as (
+		select p.n, p.bound, (select max(taken_at) from balance_snapshot_runs where taken_at <= p.bound) as taken_at
+		from points p
+	)
+	select s.n, m.currency, sum(m.amount)
+	from snaps s
+	cross join lateral (
+		select b.currency, b.amount from balance_snapshots b
+		where b.taken_at = s.taken_at and b.pocket_id in (select id from owned)
+		union all
+		select t.currency, t.amount from transactions t
+		where t.pocket_id in (select id from owned)
+			and t.created_at >= coalesce(s.taken_at, '-infinity') and t.created_at < s.bound
+	) m
+	group by s.n, m.currency
+	having sum(m.amount) <> 0`
+	err := eachRow(ctx, s.DB, balances, []any{userID, pq.Array(bounds)}, func(rows *sql.Rows) error {
+		var n int
+		var currency string
+		var amount float64
+		if err := rows.Scan(&n, &currency, &amount); err != nil {
+			return err
+		}
+		history[n-1].Balances[currency] = amount
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance history: %w", err)
+	}
+
+	rates := `with ` + points + `
+	select p.n, r.from_currency, r.rate, r.fetched_at
+	from points p
+	cross join lateral (
+		select distinct on (from_currency) from_currency, rate, fetched_at
+		from rate_history
+		where to_currency = $1 and fetched_at < p.bound
+		order by from_currency, fetched_at desc
+	) r`
+	err = eachRow(ctx, s.DB, rates, []any{currency, pq.Array(bounds)}, func(rows *sql.Rows) error {
+		var n int
+		r := storages.Rate{ToCurrency: currency}
+		if err := rows.Scan(&n, &r.FromCurrency, &r.Rate, &r.FetchedAt); err != nil {
+			return err
+		}
+		r.FetchedAt = r.FetchedAt.UTC()
+		history[n-1].Rates[r.FromCurrency] = r
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate history: %w", err)
+	}
+	return history, nil
+}
+
+// eachRow run the query and call scan for every row
+func eachRow(ctx context.Context, db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,330 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gw-currncy-wallet/internal/apperr"
+
+	"github.com/lib/pq"
+)
+
+// Webhook event types
+const (
+	EventDeposit      = "deposit.completed"
+	EventWithdrawal   = "withdrawal.completed"
+	EventExchange     = "exchange.completed"
+	EventReversal     = "transaction.reversed"
+	EventHoldPlaced   = "hold.placed"
+	EventHoldCaptured = "hold.captured"
+	EventHoldReleased = "hold.released"
+	EventHoldExpired  = "hold.expired"
+)
+
+// EventTypes lists every event a webhook can subscribe to
+var EventTypes = []string{
+	EventDeposit, EventWithdrawal, EventExchange, EventReversal,
+	EventHoldPlaced, EventHoldCaptured, EventHoldReleased, EventHoldExpired,
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookEndpoint receives events of one user, or of every user when UserID is nil
+type WebhookEndpoint struct {
+	ID         int64     `json:"id"`
+	UserID     *int      `json:"user_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent to one endpoint
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	EndpointID    int64      `json:"endpoint_id"`
+	EventID       int64      `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastStatus    *int       `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// DueDelivery is a claimed delivery with everything needed to send it
+type DueDelivery struct {
+	ID             int64
+	EventID        int64
+	EventType      string
+	Attempts       int
+	URL            string
+	Secret         string
+	Payload        json.RawMessage
+	EventCreatedAt time.Time
+}
+
+// ExchangeEvent is the payload of exchange.completed
+type ExchangeEvent struct {
+	From Transaction `json:"from"`
+	To   Transaction `json:"to"`
+	Rate float64     `json:"rate"`
+}
+
+// HoldEvent is the payload of the hold.* events, a capture carries its ledger entry
+type HoldEvent struct {
+	Hold        Hold         `json:"hold"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+// ReversalEvent is the payload of transaction.reversed
+type ReversalEvent struct {
+	Original []Transaction `json:"original"`
+	Entries  []Transaction `json:"entries"`
+}
+
+// enqueueEvent write the event to the outbox inside the transaction which changed the balance,
+// so an event is published if and only if the change is committed
+func enqueueEvent(ctx context.Context, tx *sql.Tx, userID int, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	query := `insert into outbox_events (user_id, event_type, payload) values ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, userID, eventType, payload); err != nil {
+		return fmt.Errorf("failed to enqueue event: %w", err)
+	}
+	return nil
+}
+
+const webhookColumns = `id, user_id, url, event_types, created_at`
+
+func scanWebhook(row scanner, w *WebhookEndpoint) error {
+	var userID sql.NullInt64
+	if err := row.Scan(&w.ID, &userID, &w.URL, pq.Array(&w.EventTypes), &w.CreatedAt); err != nil {
+		return err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		w.UserID = &id
+	}
+	return nil
+}
+
+// CreateWebhook register endpoint, userID nil subscribes to events of every user
+func (s *StorageConn) CreateWebhook(ctx context.Context, userID *int, url, secret string, eventTypes []string) (*WebhookEndpoint, error) {
+	var w WebhookEndpoint
+	query := `insert into webhook_endpoints (user_id, url, secret, event_types)
+	values ($1, $2, $3, $4)
+	returning ` + webhookColumns
+	err := scanWebhook(s.DB.QueryRowContext(ctx, query, userID, url, secret, pq.Array(eventTypes)), &w)
+	if isForeignKeyViolation(err) {
+		return nil, apperr.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	w.Secret = secret
+	return &w, nil
+}
+
+// Webhooks return endpoints of the owner, ownerID 0 lists all endpoints
+func (s *StorageConn) Webhooks(ctx context.Context, ownerID int) ([]WebhookEndpoint, error) {
+	query := `select ` + webhookColumns + `
+	from webhook_endpoints
+	where $1 = 0 or user_id = $1
+	order by id`
+
+	rows, err := s.DB.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		var w WebhookEndpoint
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, w)
+	}
+	return endpoints, rows.Err()
+}
+
+// DeleteWebhook remove the endpoint with its deliveries, ownerID 0 may delete any endpoint
+func (s *StorageConn) DeleteWebhook(ctx context.Context, ownerID int, id int64) error {
+	result, err := s.DB.ExecContext(ctx, `delete from webhook_endpoints where id = $1 and ($2 = 0 or user_id = $2)`, id, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", apperr.ErrWebhookNotFound, id)
+	}
+	return nil
+}
+
+const deliveryColumns = `d.id, d.endpoint_id, d.event_id, e.event_type, d.status, d.attempts, d.next_attempt_at,
+	d.last_status, coalesce(d.last_error, ''), d.delivered_at, d.created_at`
+
+func scanDelivery(row scanner, d *WebhookDelivery) error {
+	return row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatus, &d.LastError, &d.DeliveredAt, &d.CreatedAt)
+}
+
+// WebhookDeliveries return latest deliveries of the endpoint, status "" lists all
+func (s *StorageConn) WebhookDeliveries(ctx context.Context, ownerID int, endpointID int64, status string, limit int) ([]WebhookDelivery, error) {
+	var exists bool
+	err := s.DB.QueryRowContext(ctx, `select exists (select 1 from webhook_endpoints where id = $1 and ($2 = 0 or user_id = $2))`, endpointID, ownerID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", apperr.ErrWebhookNotFound, endpointID)
+	}
+
+	query := `select ` + deliveryColumns + `
+	from webhook_deliveries d
+	join outbox_events e on e.id = d.event_id
+	where d.endpoint_id = $1 and ($2 = '' or d.status = $2)
+	order by d.created_at desc, d.id desc
+	limit $3`
+
+	rows, err := s.DB.QueryContext(ctx, query, endpointID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ReplayDelivery schedule the delivery to be sent again right away with a fresh attempt budget.
+// Dead and already delivered events can both be replayed.
+func (s *StorageConn) ReplayDelivery(ctx context.Context, ownerID int, endpointID, deliveryID int64) (*WebhookDelivery, error) {
+	query := `with replayed as (
+		update webhook_deliveries d
+		set status = 'pending', attempts = 0, next_attempt_at = now(), last_error = null, updated_at = now()
+		from webhook_endpoints w
+		where d.id = $1 and d.endpoint_id = $3 and w.id = d.endpoint_id and ($2 = 0 or w.user_id = $2)
+		returning d.*
+	)
+	select ` + deliveryColumns + `
+	from replayed d
+	join outbox_events e on e.id = d.event_id`
+
+	var d WebhookDelivery
+	err := scanDelivery(s.DB.QueryRowContext(ctx, query, deliveryID, ownerID, endpointID), &d)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", apperr.ErrDeliveryNotFound, deliveryID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// FanOutEvents create deliveries of up to limit undispatched outbox events for every
+// subscribed endpoint and mark the events dispatched. Return how many events were handled.
+func (s *StorageConn) FanOutEvents(ctx context.Context, limit int) (int, error) {
+	query := `with events as (
+		select id, user_id, event_type from outbox_events
+		where dispatched_at is null
+		order by id
+		limit $1
+		for update skip locked
+	), fanned as (
+		insert into webhook_deliveries (endpoint_id, event_id)
+		select w.id, e.id
+		from events e
+		join webhook_endpoints w on (w.user_id = e.user_id or w.user_id is null) and e.event_type = any(w.event_types)
+		on conflict do nothing
+	)
+	update outbox_events set dispatched_at = now()
+	where id in (select id from events)`
+
+	result, err := s.DB.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fan out events: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// ClaimDeliveries take up to limit due deliveries and count the attempt. Claimed rows are
+// pushed lease into the future, so a crashed dispatcher only delays them and several
+// instances never send the same attempt.
+func (s *StorageConn) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	query := `with due as (
+		select id from webhook_deliveries
+		where status = 'pending' and next_attempt_at <= now()
+		order by next_attempt_at
+		limit $1
+		for update skip locked
+	)
+	update webhook_deliveries d
+	set attempts = d.attempts + 1, next_attempt_at = now() + make_interval(secs => $2), updated_at = now()
+	from due, webhook_endpoints w, outbox_events e
+	where d.id = due.id and w.id = d.endpoint_id and e.id = d.event_id
+	returning d.id, d.event_id, e.event_type, d.attempts, w.url, w.secret, e.payload, e.created_at`
+
+	rows, err := s.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []DueDelivery
+	for rows.Next() {
+		var d DueDelivery
+		if err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.Attempts, &d.URL, &d.Secret, &d.Payload, &d.EventCreatedAt); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// CompleteDelivery mark the delivery as accepted by the endpoint
+func (s *StorageConn) CompleteDelivery(ctx context.Context, id int64, httpStatus int) error {
+	query := `update webhook_deliveries
+	set status = 'delivered', last_status = $2, last_error = null, delivered_at = now(), updated_at = now()
+	where id = $1`
+	if _, err := s.DB.ExecContext(ctx, query, id, httpStatus); err != nil {
+		return fmt.Errorf("failed to complete delivery: %w", err)
+	}
+	return nil
+}
+
+// FailDelivery record failed attempt and schedule the retry, retryAt nil dead-letters the delivery.
+// httpStatus is 0 when no response was received.
+func (s *StorageConn) FailDelivery(ctx context.Context, id int64, httpStatus int, reason string, retryAt *time.Time) error {
+	query := `update webhook_deliveries
+	set status = case when $4::timestamptz is null then 'dead' else 'pending' end,
+		next_attempt_at = coalesce($4, next_attempt_at),
+		last_status = nullif($2, 0), last_error = $3, updated_at = now()
+	where id = $1`
+	if _, err := s.DB.ExecContext(ctx, query, id, httpStatus, reason, retryAt); err != nil {
+		return fmt.Errorf("failed to record delivery failure: %w", err)
+	}
+	return nil
+}
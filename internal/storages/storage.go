@@ -1,6 +1,19 @@
 package storages
 
+import (
+	"context"
+	"time"
+)
+
+// Rate is an exchange rate quote with the moment it was fetched from the exchanger
+type Rate struct {
+	FromCurrency string    `json:"from_currency"`
+	ToCurrency   string    `json:"to_currency"`
+	Rate         float64   `json:"rate"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
 type Storage interface {
-	GetAllExchangeRates() (map[string]float32, error)
-	GetExchangeRates(from_currency, to_currnecy string) (float32, error)
+	GetAllExchangeRates(ctx context.Context) ([]Rate, error)
+	GetExchangeRates(ctx context.Context, fromCurrency, toCurrency string) (Rate, error)
 }
@@ -0,0 +1,83 @@
+package tlsutil_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gw-currncy-wallet/internal/fakeexchanger"
+	"gw-currncy-wallet/internal/tlsutil"
+
+	proto_exchange "github.com/apelsinkoo09/proto-exchange/exchange"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// startMTLSExchanger run the fake exchanger on a local port, requiring client certificates
+// signed by the generated CA, and return its address and the certificate directory
+func startMTLSExchanger(t *testing.T) (addr, dir string) {
+	t.Helper()
+
+	dir = t.TempDir()
+	if err := tlsutil.GenerateTestCertificates(dir, []string{"localhost", "127.0.0.1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := tlsutil.ServerConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := fakeexchanger.NewServer(fakeexchanger.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsCfg)))
+	fakeexchanger.Register(gs, srv)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	return lis.Addr().String(), dir
+}
+
+func TestMutualTLS(t *testing.T) {
+	addr, dir := startMTLSExchanger(t)
+	ca := filepath.Join(dir, "ca.crt")
+	cert, key := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+
+	tests := []struct {
+		name       string
+		cert, key  string
+		serverName string
+		ok         bool
+	}{
+		{name: "client certificate", cert: cert, key: key, serverName: "localhost", ok: true},
+		{name: "no client certificate", serverName: "localhost"},
+		{name: "wrong server name", cert: cert, key: key, serverName: "exchanger.invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsCfg, err := tlsutil.ClientConfig(ca, tt.cert, tt.key, tt.serverName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = proto_exchange.NewExchangeServiceClient(conn).GetExchangeRates(ctx, &proto_exchange.Empty{})
+			if (err == nil) != tt.ok {
+				t.Fatalf("GetExchangeRates error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
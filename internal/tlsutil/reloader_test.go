@@ -0,0 +1,77 @@
+package tlsutil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyPair copy the key pair name from src into cert.pem and key.pem of dst, dated at
+func copyPair(t *testing.T, src, name, dst string, at time.Time) {
+	t.Helper()
+
+	for from, to := range map[string]string{name + ".crt": "cert.pem", name + ".key": "key.pem"} {
+		data, err := os.ReadFile(filepath.Join(src, from))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dst, to)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func servedCert(t *testing.T, r *CertReloader) []byte {
+	t.Helper()
+
+	// Skip the wait between checks of the files
+	r.mu.Lock()
+	r.checkedAt = time.Time{}
+	r.mu.Unlock()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertReloaderPicksUpRotation(t *testing.T) {
+	certs := t.TempDir()
+	if err := GenerateTestCertificates(certs, []string{"localhost"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Minute)
+	copyPair(t, certs, "server", dir, start)
+
+	r, err := NewCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := servedCert(t, r)
+
+	copyPair(t, certs, "client", dir, start.Add(time.Second))
+	rotated := servedCert(t, r)
+	if bytes.Equal(rotated, first) {
+		t.Fatal("the rewritten key pair is not served")
+	}
+
+	// A half written rotation keeps the last good pair
+	broken := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(broken, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(broken, start.Add(2*time.Second), start.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(servedCert(t, r), rotated) {
+		t.Fatal("a broken key pair replaced the served one")
+	}
+}
@@ -0,0 +1,196 @@
+// Package webhooks delivers outbox events to registered endpoints.
+// Every request is signed with HMAC-SHA256 of the endpoint secret over "<timestamp>.<body>",
+// failed deliveries are retried with exponential backoff and dead-lettered after the last attempt.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gw-currncy-wallet/internal/config"
+	"gw-currncy-wallet/internal/metrics"
+	postgres "gw-currncy-wallet/internal/storages/postgres"
+)
+
+// Headers of every delivery
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the JSON body of a delivery. ID is the outbox event id, stable across retries,
+// so receivers can drop duplicates.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Dispatcher struct {
+	db     *postgres.StorageConn
+	client *http.Client
+	cfg    config.Webhooks
+}
+
+// NewDispatcher create dispatcher of outbox events
+func NewDispatcher(db *postgres.StorageConn, cfg config.Webhooks) *Dispatcher {
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: TargetPolicy{AllowPrivate: cfg.AllowPrivateTargets}.Transport(),
+			// A redirect could point the signed payload anywhere, treat it as a failure
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		cfg: cfg,
+	}
+}
+
+// Sign return the signature header value for the body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run poll the outbox every PollInterval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.poll(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("webhook dispatch failed", "error", err)
+			}
+		}
+	}
+}
+
+// poll fan out new events, then send the due deliveries
+func (d *Dispatcher) poll(ctx context.Context) error {
+	if _, err := d.db.FanOutEvents(ctx, d.cfg.BatchSize); err != nil {
+		return err
+	}
+
+	// The lease outlives the request timeout, a delivery is never sent twice at once
+	due, err := d.db.ClaimDeliveries(ctx, d.cfg.BatchSize, 2*d.cfg.Timeout+time.Minute)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan postgres.DueDelivery)
+	var wg sync.WaitGroup
+	for i := 0; i < min(d.cfg.Workers, len(due)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				d.deliver(ctx, job)
+			}
+		}()
+	}
+	for _, job := range due {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
+
+// deliver send one delivery and record the outcome
+func (d *Dispatcher) deliver(ctx context.Context, job postgres.DueDelivery) {
+	start := time.Now()
+	status, err := d.send(ctx, job)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down, the lease brings the delivery back after restart
+		return
+	}
+	// The outcome is recorded even if shutdown starts right after the request
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		metrics.WebhookDelivery("delivered", time.Since(start))
+		if err := d.db.CompleteDelivery(ctx, job.ID, status); err != nil {
+			slog.Error("failed to record webhook delivery", "delivery_id", job.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	result := "dead"
+	if job.Attempts < d.cfg.MaxAttempts {
+		at := time.Now().Add(d.backoff(job.Attempts))
+		retryAt, result = &at, "retry"
+	}
+	metrics.WebhookDelivery(result, time.Since(start))
+	slog.Warn("webhook delivery failed", "delivery_id", job.ID, "url", job.URL, "attempt", job.Attempts, "result", result, "error", err)
+
+	if err := d.db.FailDelivery(ctx, job.ID, status, err.Error(), retryAt); err != nil {
+		slog.Error("failed to record webhook delivery", "delivery_id", job.ID, "error", err)
+	}
+}
+
+// send post the signed event, any 2xx response is a success
+func (d *Dispatcher) send(ctx context.Context, job postgres.DueDelivery) (int, error) {
+	body, err := json.Marshal(Event{ID: job.EventID, Type: job.EventType, CreatedAt: job.EventCreatedAt, Data: job.Payload})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gw-currency-wallet-webhooks/1")
+	req.Header.Set(HeaderID, strconv.FormatInt(job.EventID, 10))
+	req.Header.Set(HeaderEvent, job.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(job.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff return delay after the failed attempt: Backoff doubled per attempt up to MaxBackoff, with jitter
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.MaxBackoff
+	if attempt < 32 {
+		if next := d.cfg.Backoff << (attempt - 1); next > 0 && next < delay {
+			delay = next
+		}
+	}
+	// Up to 20% jitter spreads retries of an endpoint that came back
+	return delay - time.Duration(rand.Int64N(int64(delay)/5+1))
+}
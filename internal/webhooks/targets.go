@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateTarget is returned for endpoints resolving to an address the wallet must not call
+var ErrPrivateTarget = errors.New("webhook target is not a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// TargetPolicy decides which hosts webhooks may be delivered to. Unless AllowPrivate is set,
+// loopback, private, link-local (cloud metadata included) and other non-public addresses are refused,
+// both when an endpoint is registered and on every connection of the dispatcher.
+type TargetPolicy struct {
+	AllowPrivate bool
+}
+
+// publicAddr reports whether a webhook may connect to the address
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL accept absolute http and https URLs whose host resolves to public addresses only
+func (p TargetPolicy) CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if p.AllowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("can not resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateTarget, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// control refuse the connection once the address is resolved, so DNS changes after
+// registration can not point deliveries at internal services
+func (p TargetPolicy) control(_, address string, _ syscall.RawConn) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, address)
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, addrPort.Addr().Unmap())
+	}
+	return nil
+}
+
+// Transport return an HTTP transport dialing only addresses allowed by the policy.
+// Proxies are not used, they would hide the real destination from the check.
+func (p TargetPolicy) Transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
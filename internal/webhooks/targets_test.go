@@ -0,0 +1,60 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		url     string
+		private bool
+		ok      bool
+	}{
+		{url: "https://93.184.215.14/hook", ok: true},
+		{url: "http://[2606:4700::1111]/hook", ok: true},
+		{url: "ftp://93.184.215.14/hook"},
+		{url: "/relative"},
+		{url: "http://127.0.0.1:8080/hook"},
+		{url: "http://[::1]/hook"},
+		{url: "http://10.1.2.3/hook"},
+		{url: "http://192.168.0.10/hook"},
+		{url: "http://100.64.0.1/hook"},
+		{url: "http://169.254.169.254/latest/meta-data/"},
+		{url: "http://[::ffff:169.254.169.254]/"},
+		{url: "http://0.0.0.0/hook"},
+		{url: "http://127.0.0.1:8080/hook", private: true, ok: true},
+	}
+	for _, tt := range tests {
+		err := TargetPolicy{AllowPrivate: tt.private}.CheckURL(ctx, tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckURL(%q, allow private %v) = %v, want ok %v", tt.url, tt.private, err, tt.ok)
+		}
+	}
+}
+
+func TestTransportRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: TargetPolicy{}.Transport()}
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrPrivateTarget) {
+		t.Fatalf("delivery to %s: err = %v, want ErrPrivateTarget", srv.URL, err)
+	}
+
+	client = &http.Client{Transport: TargetPolicy{AllowPrivate: true}.Transport()}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", resp.StatusCode)
+	}
+}